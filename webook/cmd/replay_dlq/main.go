@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/ClearloveHn/golangwebook/webook/internal/events/article"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
+	"github.com/IBM/sarama"
+	"go.uber.org/zap"
+	"os"
+	"strings"
+	"time"
+)
+
+// 把文章阅读事件的死信消息重新发送到 article_read,用于恢复丢失的阅读数和历史记录
+// 用法: go run ./cmd/replay_dlq -brokers localhost:9094
+// 重复执行是安全的,已经重放过的消息不会再重放
+func main() {
+	brokers := flag.String("brokers", "localhost:9094", "Kafka 的地址,多个用逗号分隔")
+	timeout := flag.Duration("timeout", time.Minute*5, "最长执行时间")
+	flag.Parse()
+
+	zl, err := zap.NewProduction()
+	if err != nil {
+		panic(err)
+	}
+	l := logger.NewZapLogger(zl)
+
+	cfg := sarama.NewConfig()
+	cfg.Producer.Return.Successes = true
+	client, err := sarama.NewClient(strings.Split(*brokers, ","), cfg)
+	if err != nil {
+		panic(err)
+	}
+	defer client.Close()
+	producer, err := sarama.NewSyncProducerFromClient(client)
+	if err != nil {
+		panic(err)
+	}
+	defer producer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	cnt, err := article.NewDLQReplayer(client, producer, l).Replay(ctx)
+	fmt.Printf("重放了 %d 条消息\n", cnt)
+	if err != nil {
+		fmt.Println("重放失败", err)
+		os.Exit(1)
+	}
+}
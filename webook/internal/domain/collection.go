@@ -0,0 +1,55 @@
+package domain
+
+import "time"
+
+// CollectionVisibility 收藏夹的可见性
+type CollectionVisibility uint8
+
+// ToUint8 将CollectionVisibility转换为uint8类型
+func (v CollectionVisibility) ToUint8() uint8 {
+	return uint8(v)
+}
+
+const (
+	// CollectionVisibilityUnknown 未知,按照私密处理
+	CollectionVisibilityUnknown CollectionVisibility = iota
+
+	// CollectionVisibilityPrivate 仅自己可见
+	CollectionVisibilityPrivate
+
+	// CollectionVisibilityPublic 所有人可见
+	CollectionVisibilityPublic
+)
+
+// Collection 收藏夹
+type Collection struct {
+	Id          int64
+	Uid         int64 // 收藏夹的主人
+	Name        string
+	Description string
+	Visibility  CollectionVisibility
+	// ItemCnt 收藏夹里面的收藏数量
+	ItemCnt int64
+	Ctime   time.Time
+	Utime   time.Time
+}
+
+// VisibleTo 收藏夹能不能被 uid 看到
+func (c Collection) VisibleTo(uid int64) bool {
+	return c.Uid == uid || c.Visibility == CollectionVisibilityPublic
+}
+
+// CollectionItem 收藏夹里面的一条收藏
+type CollectionItem struct {
+	Id    int64
+	Cid   int64
+	Uid   int64
+	Biz   string
+	BizId int64
+
+	// Title 和 Abstract 是查询的时候从文章里面补全的
+	Title    string
+	Abstract string
+
+	Ctime time.Time
+}
@@ -1,8 +1,59 @@
 package domain
 
+import "time"
+
 // HistoryRecord 表示一条历史记录
+// 同一个用户反复浏览同一个业务只有一条记录,Utime 是最后一次浏览的时间
 type HistoryRecord struct {
+	Id    int64
 	BizId int64  // 业务ID,用于标识不同的业务类型
 	Biz   string // 业务名称,用于描述业务的具体内容
 	Uid   int64  // 用户ID,表示该历史记录所属的用户
+
+	// Position 最近一次上报的滚动位置,继续阅读的时候从这里开始
+	Position int64
+	// Progress 最近一次上报的阅读进度,0 到 100
+	Progress int
+	// MaxProgress 读到过的最大进度,用于判断是否读完
+	MaxProgress int
+	// Duration 累计的阅读时长
+	Duration time.Duration
+
+	// Title 和 Abstract 是查询的时候从文章里面补全的
+	Title    string
+	Abstract string
+
+	Ctime time.Time
+	Utime time.Time
+}
+
+// FinishedProgress 进度达到这个值就认为读完了,文章末尾的评论之类的一般不会看完
+const FinishedProgress = 95
+
+// Finished 是否读完了
+func (r HistoryRecord) Finished() bool {
+	return r.MaxProgress >= FinishedProgress
+}
+
+// ReadProgress 客户端上报的阅读进度
+type ReadProgress struct {
+	Uid      int64
+	Biz      string
+	BizId    int64
+	Position int64
+	Progress int
+	// Duration 距离上一次上报的阅读时长,会累加到浏览记录上
+	Duration time.Duration
+}
+
+// HistoryCursor 浏览记录的游标,按照浏览时间倒序翻页
+// 零值表示第一页,下一页的游标是上一页最后一条记录的 Utime 和 Id
+type HistoryCursor struct {
+	Utime time.Time
+	Id    int64
+}
+
+// IsZero 是不是第一页
+func (c HistoryCursor) IsZero() bool {
+	return c.Id == 0 && c.Utime.IsZero()
 }
@@ -3,9 +3,26 @@ package domain
 // Interactive 表示一个交互数据的结构体
 type Interactive struct {
 	BizId      int64 // 业务ID,用于标识不同的业务类型,如文章、评论等
-	ReadCnt    int64 // 阅读数,表示该业务被阅读的次数
+	ReadCnt    int64 // 阅读数,表示该业务被阅读的次数,同一个读者在去重窗口内只算一次
+	RawReadCnt int64 // 原始阅读数,每次阅读都算,用于分析
 	LikeCnt    int64 // 点赞数,表示该业务被点赞的次数
 	CollectCnt int64 // 收藏数,表示该业务被收藏的次数
 	Liked      bool  // 是否已点赞,表示当前用户是否对该业务点过赞
 	Collected  bool  // 是否已收藏,表示当前用户是否已收藏该业务
+
+	Reactions   map[string]int64 // 每种表态的数量,点赞也在里面
+	MyReactions []string         // 当前用户的表态
+}
+
+// ReactionLike 点赞是内置的表态,不需要配置,数量就是 LikeCnt
+const ReactionLike = "like"
+
+// InteractiveDelta 还没有写回数据库的计数增量,可以是负数
+// 点赞数不走增量,写回的时候按照点赞记录重新计算
+type InteractiveDelta struct {
+	Biz        string
+	BizId      int64
+	ReadCnt    int64
+	RawReadCnt int64
+	CollectCnt int64
 }
@@ -0,0 +1,13 @@
+package domain
+
+import "time"
+
+// OutboxEvent 表示一条等待发送的事件
+// 事件先写入数据库,再由后台任务发送到消息队列,这样消息队列暂时不可用或者进程退出都不会丢事件
+type OutboxEvent struct {
+	Id      int64
+	Topic   string // 事件要发送到哪一个 topic
+	Payload []byte // JSON 格式的事件内容
+	Retries int    // 已经发送失败了多少次
+	Ctime   time.Time
+}
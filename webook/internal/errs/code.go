@@ -22,6 +22,30 @@ const (
 	// ArticleInvalidInput 表示文章模块的输入错误,常量值为 402001
 	ArticleInvalidInput = 402001
 
+	// ArticleNotFound 表示文章不存在或者已经撤回了,常量值为 402002
+	ArticleNotFound = 402002
+
 	// ArticleInternalServerError 表示文章模块的系统内部错误,常量值为 502001
 	ArticleInternalServerError = 502001
 )
+
+// History 浏览记录相关的错误码
+const (
+	// HistoryInvalidInput 表示浏览记录模块的输入错误,常量值为 403001
+	HistoryInvalidInput = 403001
+
+	// HistoryInternalServerError 表示浏览记录模块的系统内部错误,常量值为 503001
+	HistoryInternalServerError = 503001
+)
+
+// Collection 收藏夹相关的错误码
+const (
+	// CollectionInvalidInput 表示收藏夹模块的输入错误,常量值为 404001
+	CollectionInvalidInput = 404001
+
+	// CollectionNotFound 表示收藏夹不存在或者没有权限,常量值为 404002
+	CollectionNotFound = 404002
+
+	// CollectionInternalServerError 表示收藏夹模块的系统内部错误,常量值为 504001
+	CollectionInternalServerError = 504001
+)
@@ -0,0 +1,195 @@
+package article
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
+	"github.com/IBM/sarama"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	ErrProducerClosed = errors.New("producer 已经关闭")
+	ErrBufferFull     = errors.New("producer 缓冲区已满")
+)
+
+// SaramaBatchProducer 异步批量发送阅读事件
+// 事件先放在内存里面,凑够 batchSize 个或者每隔 interval 发送一次。
+// 同一批里面的事件按照 aid 分组,每一组合并成一个 BatchReadEvent 发送到 TopicBatchReadEvent,
+// 分组的方式和 sarama 默认的 hash 分区器一样,所以同一篇文章的事件总是落在同一个分区上,保证顺序。
+// 要求 producer 使用默认的 hash 分区器。
+// 内存里面的事件在进程崩溃的时候会丢失,只适合允许丢失少量事件的场景。
+// 不能作为 outbox Relay 的 producer:ProduceReadEvent 返回的时候 kafka 还没有确认,
+// Relay 紧接着就会 MarkSent,事件丢失之后不会再发送。不能丢的场景用 outbox + SaramaSyncProducer。
+type SaramaBatchProducer struct {
+	client      sarama.Client
+	producer    sarama.AsyncProducer
+	partitioner sarama.Partitioner
+	batchSize   int
+	interval    time.Duration
+	// onError 发送失败的回调,evts 是这一条消息里面的所有事件
+	onError func(evts []ReadEvent, err error)
+
+	events  chan ReadEvent
+	mu      sync.RWMutex
+	closed  bool
+	closing chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewSaramaBatchProducer 创建之后就开始在后台发送,不再使用的时候必须调用 Close
+// onError 为 nil 的时候只打印日志
+func NewSaramaBatchProducer(client sarama.Client, batchSize int, interval time.Duration,
+	onError func(evts []ReadEvent, err error), l logger.LoggerV1) (*SaramaBatchProducer, error) {
+	producer, err := sarama.NewAsyncProducerFromClient(client)
+	if err != nil {
+		return nil, err
+	}
+	if onError == nil {
+		onError = func(evts []ReadEvent, err error) {
+			l.Error("发送批量阅读事件失败",
+				logger.Int("cnt", len(evts)),
+				logger.Error(err))
+		}
+	}
+	p := &SaramaBatchProducer{
+		client:      client,
+		producer:    producer,
+		partitioner: sarama.NewHashPartitioner(TopicBatchReadEvent),
+		batchSize:   batchSize,
+		interval:    interval,
+		onError:     onError,
+		// 留出一些余量,避免发送的时候阻塞住生产者
+		events:  make(chan ReadEvent, batchSize*4),
+		closing: make(chan struct{}),
+	}
+	p.wg.Add(3)
+	go p.loop()
+	go p.handleErrors()
+	go p.drainSuccesses()
+	return p, nil
+}
+
+// ProduceReadEvent 把事件放到缓冲区里面,不会阻塞,缓冲区满了的时候返回 ErrBufferFull
+func (p *SaramaBatchProducer) ProduceReadEvent(evt ReadEvent) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrProducerClosed
+	}
+	select {
+	case p.events <- evt:
+		return nil
+	default:
+		return ErrBufferFull
+	}
+}
+
+// Close 停止接收新的事件,把缓冲区里面的事件全部发送出去之后再返回
+func (p *SaramaBatchProducer) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	close(p.closing)
+	p.wg.Wait()
+	return nil
+}
+
+func (p *SaramaBatchProducer) loop() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	buf := make([]ReadEvent, 0, p.batchSize)
+	for {
+		select {
+		case evt := <-p.events:
+			buf = append(buf, evt)
+			if len(buf) >= p.batchSize {
+				p.flush(buf)
+				buf = buf[:0]
+			}
+		case <-ticker.C:
+			p.flush(buf)
+			buf = buf[:0]
+		case <-p.closing:
+			// 已经不会有新的事件进来了,把剩下的发送完
+			for {
+				select {
+				case evt := <-p.events:
+					buf = append(buf, evt)
+				default:
+					p.flush(buf)
+					// 等 sarama 把消息都发送出去,Errors 和 Successes 会被关闭
+					p.producer.AsyncClose()
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush 按照分区分组,每一组发送一条消息
+func (p *SaramaBatchProducer) flush(buf []ReadEvent) {
+	if len(buf) == 0 {
+		return
+	}
+	partitions, err := p.client.Partitions(TopicBatchReadEvent)
+	if err != nil {
+		p.onError(append([]ReadEvent(nil), buf...), err)
+		return
+	}
+
+	groups := make(map[int32][]ReadEvent)
+	for _, evt := range buf {
+		partition, err := p.partitioner.Partition(&sarama.ProducerMessage{
+			Key: aidKey(evt.Aid),
+		}, int32(len(partitions)))
+		if err != nil {
+			p.onError([]ReadEvent{evt}, err)
+			continue
+		}
+		groups[partition] = append(groups[partition], evt)
+	}
+
+	for _, evts := range groups {
+		val, err := json.Marshal(NewBatchReadEvent(evts))
+		if err != nil {
+			p.onError(evts, err)
+			continue
+		}
+		p.producer.Input() <- &sarama.ProducerMessage{
+			Topic: TopicBatchReadEvent,
+			// 同一组的 aid 算出来的分区都是一样的,用第一个就可以
+			Key:      aidKey(evts[0].Aid),
+			Value:    sarama.ByteEncoder(val),
+			Metadata: evts,
+		}
+	}
+}
+
+func (p *SaramaBatchProducer) handleErrors() {
+	defer p.wg.Done()
+	for pErr := range p.producer.Errors() {
+		evts, _ := pErr.Msg.Metadata.([]ReadEvent)
+		p.onError(evts, pErr.Err)
+	}
+}
+
+// drainSuccesses 配置了 Producer.Return.Successes 的时候必须读取,不然会阻塞
+func (p *SaramaBatchProducer) drainSuccesses() {
+	defer p.wg.Done()
+	for range p.producer.Successes() {
+	}
+}
+
+func aidKey(aid int64) sarama.Encoder {
+	return sarama.StringEncoder(strconv.FormatInt(aid, 10))
+}
@@ -2,66 +2,185 @@ package article
 
 import (
 	"context"
+	"github.com/ClearloveHn/golangwebook/webook/internal/events"
+	"github.com/ClearloveHn/golangwebook/webook/internal/repository"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/samarax"
 	"github.com/IBM/sarama"
 	"time"
 )
 
 // 使用 Sarama 客户端和 samarax 包来实现 Kafka 消息的消费和处理
 
+// interactiveConsumerName 转发到重试 topic 的时候放在消息头里面
+const interactiveConsumerName = "interactive"
+
+// defaultInteractiveConsumerConfig 阅读计数消费者的默认配置
+var defaultInteractiveConsumerConfig = events.ConsumerConfig{
+	GroupId:        "interactive",
+	Topics:         []string{TopicReadEvent, TopicBatchReadEvent},
+	BatchSize:      10,
+	BatchDuration:  time.Second,
+	CommitStrategy: samarax.CommitAuto,
+}
+
 type InteractiveReadEventConsumer struct {
-	repo   repository.InteractiveRepository
-	client sarama.Client // Sarama客户端,用于连接和消费Kafka消息
-	l      logger.LoggerV1
+	repo      repository.InteractiveRepository
+	client    sarama.Client // Sarama客户端,用于连接和消费Kafka消息
+	forwarder *RetryForwarder
+	dedup     *events.Deduplicator
+	window    *ReadWindowPolicy
+	cfg       events.ConsumerConfig
+	cgs       []sarama.ConsumerGroup
+	l         logger.LoggerV1
 }
 
 func NewInteractiveReadEventConsumer(repo repository.InteractiveRepository,
-	client sarama.Client, l logger.LoggerV1) *InteractiveReadEventConsumer {
-	return &InteractiveReadEventConsumer{repo: repo, client: client, l: l}
+	client sarama.Client, producer sarama.SyncProducer, dedup *events.Deduplicator,
+	window *ReadWindowPolicy, cfg events.ConsumerConfig, l logger.LoggerV1) *InteractiveReadEventConsumer {
+	return &InteractiveReadEventConsumer{
+		repo:      repo,
+		client:    client,
+		forwarder: NewRetryForwarder(producer, interactiveConsumerName),
+		dedup:     dedup,
+		window:    window,
+		cfg:       cfg.WithDefault(defaultInteractiveConsumerConfig),
+		l:         l,
+	}
 }
 
 // Start 用于启动消费者
 func (consumer *InteractiveReadEventConsumer) Start() error {
-	// 使用Sarama客户端创建一个新的消费者组
-	cg, err := sarama.NewConsumerGroupFromClient("interactive", consumer.client)
+	cfg := consumer.cfg
+	// 使用 samarax 包的 NewBatchHandler 函数创建一个批量处理器,用于批量处理消息
+	// 重试之后依旧失败的这一批转发到重试 topic
+	// 批量阅读事件本身就是一批,逐条处理就可以
+	router := samarax.NewRouter().
+		Handle(TopicReadEvent, samarax.NewBatchHandler[ReadEvent](consumer.l, consumer.BatchConsume).
+			WithBatchSize(cfg.BatchSize).
+			WithBatchDuration(cfg.BatchDuration).
+			WithCommitStrategy(cfg.CommitStrategy).
+			WithFallback(consumer.forwarder.Forward)).
+		Handle(TopicBatchReadEvent, samarax.NewHandler[BatchReadEvent](consumer.l, consumer.ConsumeBatchEvent).
+			WithCommitStrategy(cfg.CommitStrategy).
+			WithFallback(consumer.forwarder.ForwardBatch))
+	err := cfg.Validate(router)
 	if err != nil {
 		return err
 	}
 
+	// 使用Sarama客户端创建一个新的消费者组
+	cg, err := sarama.NewConsumerGroupFromClient(cfg.GroupId, consumer.client)
+	if err != nil {
+		return err
+	}
 	// 在新的协程中启动消费者组,并消费指定主题的消息
-	go func() {
-		// 使用 samarax 包的 NewBatchHandler 函数创建一个批量处理器,用于批量处理消息
-		er := cg.Consume(context.Background(),
-			[]string{TopicReadEvent},
-			samarax.NewBatchHandler[ReadEvent](i.l, i.BatchConsume))
-		if er != nil {
-			i.l.Error("退出消费", logger.Error(er))
-		}
-	}()
-	return err
+	go events.ConsumeLoop(cg, cfg.Topics, router, consumer.l)
+
+	// 重试 topic 里面的消息量很小,逐条处理就可以
+	retryCg, err := startRetryConsumer(consumer.client, cfg, interactiveConsumerName,
+		consumer.forwarder, consumer.l, consumer.Consume)
+	if err != nil {
+		_ = cg.Close()
+		return err
+	}
+	consumer.cgs = []sarama.ConsumerGroup{cg, retryCg}
+	return nil
+}
+
+// Stop 停止消费
+func (consumer *InteractiveReadEventConsumer) Stop() error {
+	return events.CloseGroups(consumer.cgs...)
 }
 
 // Consume 用于单个消费和处理交互式阅读事件
 func (consumer *InteractiveReadEventConsumer) Consume(msg *sarama.ConsumerMessage, event ReadEvent) error {
-
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
-
-	// 增加阅读计数
-	return consumer.repo.IncrReadCnt(ctx, "article", event.Aid)
+	return consumer.incrReadCnt([]ReadEvent{event})
 }
 
 // BatchConsume 用于批量消费和处理交互式阅读事件
 func (consumer *InteractiveReadEventConsumer) BatchConsume(msgs []*sarama.ConsumerMessage,
 	events []ReadEvent) error {
-	bizs := make([]string, 0, len(events))
-	bizIds := make([]int64, 0, len(events))
-	for _, evt := range events {
-		bizs = append(bizs, "article")
-		bizIds = append(bizIds, evt.Aid)
+	evts := make([]ReadEvent, 0, len(events))
+	for idx, evt := range events {
+		// 别的消费者处理失败之后重放的消息
+		if !IsFor(msgs[idx], interactiveConsumerName) {
+			continue
+		}
+		evts = append(evts, evt)
+	}
+	return consumer.incrReadCnt(evts)
+}
+
+// ConsumeBatchEvent 处理 SaramaBatchProducer 发送的批量阅读事件
+func (consumer *InteractiveReadEventConsumer) ConsumeBatchEvent(msg *sarama.ConsumerMessage,
+	event BatchReadEvent) error {
+	return consumer.incrReadCnt(event.Events())
+}
+
+// incrReadCnt 丢弃处理过的事件之后增加阅读计数,计数成功之后才标记为处理过,失败的释放掉等重试
+// 去重窗口内的重复阅读只计入原始阅读数
+func (consumer *InteractiveReadEventConsumer) incrReadCnt(evts []ReadEvent) error {
+	if len(evts) == 0 {
+		return nil
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 
-	return consumer.repo.BatchIncrReadCnt(ctx, bizs, bizIds)
+	fresh, err := consumer.dedup.Claim(ctx, interactiveConsumerName, readEventIds(evts))
+	if err != nil {
+		return err
+	}
+	freshEvts := make([]ReadEvent, 0, len(evts))
+	for idx, evt := range evts {
+		if fresh[idx] {
+			freshEvts = append(freshEvts, evt)
+		}
+	}
+	if len(freshEvts) == 0 {
+		return nil
+	}
+
+	counted := consumer.window.Filter(ctx, "article", freshEvts)
+	var countedEvts, rawEvts []ReadEvent
+	for idx, evt := range freshEvts {
+		if counted[idx] {
+			countedEvts = append(countedEvts, evt)
+		} else {
+			rawEvts = append(rawEvts, evt)
+		}
+	}
+
+	// 两部分分别标记,后一部分失败重试的时候前一部分不会重复计数
+	err = consumer.batchIncr(ctx, countedEvts, consumer.repo.BatchIncrReadCnt)
+	if err != nil {
+		consumer.dedup.Release(ctx, interactiveConsumerName, readEventIds(freshEvts))
+		return err
+	}
+	err = consumer.batchIncr(ctx, rawEvts, consumer.repo.BatchIncrRawReadCnt)
+	if err != nil {
+		consumer.dedup.Release(ctx, interactiveConsumerName, readEventIds(rawEvts))
+		return err
+	}
+	return nil
+}
+
+func (consumer *InteractiveReadEventConsumer) batchIncr(ctx context.Context, evts []ReadEvent,
+	incr func(ctx context.Context, bizs []string, bizIds []int64) error) error {
+	if len(evts) == 0 {
+		return nil
+	}
+	bizs := make([]string, 0, len(evts))
+	bizIds := make([]int64, 0, len(evts))
+	for _, evt := range evts {
+		bizs = append(bizs, "article")
+		bizIds = append(bizIds, evt.Aid)
+	}
+	err := incr(ctx, bizs, bizIds)
+	if err != nil {
+		return err
+	}
+	consumer.dedup.Mark(ctx, interactiveConsumerName, readEventIds(evts))
+	return nil
 }
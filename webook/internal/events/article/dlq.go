@@ -0,0 +1,134 @@
+package article
+
+import (
+	"context"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
+	"github.com/IBM/sarama"
+)
+
+// dlqReplayGroup 记录死信消息重放到哪里了,重复执行不会重复重放
+const dlqReplayGroup = "article_read_dlq_replay"
+
+// DLQReplayer 把死信 topic 里面的消息重新发送到 TopicReadEvent
+// 消息头里面的消费者名字会保留,所以只有当初处理失败的那个消费者会再处理一次
+type DLQReplayer struct {
+	client   sarama.Client
+	producer sarama.SyncProducer
+	l        logger.LoggerV1
+}
+
+func NewDLQReplayer(client sarama.Client, producer sarama.SyncProducer, l logger.LoggerV1) *DLQReplayer {
+	return &DLQReplayer{client: client, producer: producer, l: l}
+}
+
+// Replay 重放所有还没有重放过的死信消息,返回重放的条数
+// 只处理开始重放的时候已经存在的消息,所以一定会结束
+func (r *DLQReplayer) Replay(ctx context.Context) (int, error) {
+	partitions, err := r.client.Partitions(TopicReadEventDLQ)
+	if err != nil {
+		return 0, err
+	}
+	om, err := sarama.NewOffsetManagerFromClient(dlqReplayGroup, r.client)
+	if err != nil {
+		return 0, err
+	}
+	defer om.Close()
+	consumer, err := sarama.NewConsumerFromClient(r.client)
+	if err != nil {
+		return 0, err
+	}
+	defer consumer.Close()
+
+	total := 0
+	for _, p := range partitions {
+		cnt, er := r.replayPartition(ctx, om, consumer, p)
+		total += cnt
+		if er != nil {
+			// 已经重放了的位移也要提交,避免下次重复重放
+			om.Commit()
+			return total, er
+		}
+	}
+	om.Commit()
+	return total, nil
+}
+
+func (r *DLQReplayer) replayPartition(ctx context.Context, om sarama.OffsetManager,
+	consumer sarama.Consumer, partition int32) (int, error) {
+	pom, err := om.ManagePartition(TopicReadEventDLQ, partition)
+	if err != nil {
+		return 0, err
+	}
+	defer pom.Close()
+
+	start, _ := pom.NextOffset()
+	if start < 0 {
+		// 从来没有重放过
+		start, err = r.client.GetOffset(TopicReadEventDLQ, partition, sarama.OffsetOldest)
+		if err != nil {
+			return 0, err
+		}
+	}
+	end, err := r.client.GetOffset(TopicReadEventDLQ, partition, sarama.OffsetNewest)
+	if err != nil {
+		return 0, err
+	}
+	if start >= end {
+		return 0, nil
+	}
+
+	pc, err := consumer.ConsumePartition(TopicReadEventDLQ, partition, start)
+	if err != nil {
+		return 0, err
+	}
+	defer pc.Close()
+
+	cnt := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return cnt, ctx.Err()
+		case cErr := <-pc.Errors():
+			return cnt, cErr
+		case msg := <-pc.Messages():
+			_, _, err = r.producer.SendMessage(r.toReplay(msg))
+			if err != nil {
+				return cnt, err
+			}
+			pom.MarkOffset(msg.Offset+1, "")
+			cnt++
+			r.l.Info("重放死信消息",
+				logger.Int32("partition", partition),
+				logger.Int64("offset", msg.Offset),
+				logger.String("consumer", header(msg, HeaderConsumer)),
+				logger.String("cause", header(msg, HeaderError)))
+			if msg.Offset+1 >= end {
+				return cnt, nil
+			}
+		}
+	}
+}
+
+// toReplay 保留消费者的名字,去掉失败原因
+func (r *DLQReplayer) toReplay(msg *sarama.ConsumerMessage) *sarama.ProducerMessage {
+	pm := &sarama.ProducerMessage{
+		Topic: TopicReadEvent,
+		Value: sarama.ByteEncoder(msg.Value),
+	}
+	if len(msg.Key) > 0 {
+		pm.Key = sarama.ByteEncoder(msg.Key)
+	}
+	if c := header(msg, HeaderConsumer); c != "" {
+		pm.Headers = []sarama.RecordHeader{{Key: []byte(HeaderConsumer), Value: []byte(c)}}
+	}
+	return pm
+}
+
+func header(msg *sarama.ConsumerMessage, key string) string {
+	for _, h := range msg.Headers {
+		if string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
@@ -3,47 +3,137 @@ package article
 import (
 	"context"
 	"github.com/ClearloveHn/golangwebook/webook/internal/domain"
+	"github.com/ClearloveHn/golangwebook/webook/internal/events"
+	"github.com/ClearloveHn/golangwebook/webook/internal/repository"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/samarax"
 	"github.com/IBM/sarama"
 	"time"
 )
 
 // 记录历史事件
 
+// historyConsumerName 转发到重试 topic 的时候放在消息头里面
+const historyConsumerName = "history"
+
+// defaultHistoryConsumerConfig 历史记录消费者的默认配置
+// 历史记录是逐条处理的,所以 BatchSize 和 BatchDuration 不生效
+var defaultHistoryConsumerConfig = events.ConsumerConfig{
+	GroupId:        "history",
+	Topics:         []string{TopicReadEvent, TopicBatchReadEvent},
+	CommitStrategy: samarax.CommitAuto,
+}
+
 type HistoryRecordConsumer struct {
-	repo   repository.HistoryRecordRepository
-	client sarama.Client // Sarama客户端,用于连接和消费Kafka消息
-	l      logger.LoggerV1
+	repo      repository.HistoryRecordRepository
+	client    sarama.Client // Sarama客户端,用于连接和消费Kafka消息
+	forwarder *RetryForwarder
+	dedup     *events.Deduplicator
+	cfg       events.ConsumerConfig
+	cgs       []sarama.ConsumerGroup
+	l         logger.LoggerV1
+}
+
+func NewHistoryRecordConsumer(repo repository.HistoryRecordRepository,
+	client sarama.Client, producer sarama.SyncProducer, dedup *events.Deduplicator,
+	cfg events.ConsumerConfig, l logger.LoggerV1) *HistoryRecordConsumer {
+	return &HistoryRecordConsumer{
+		repo:      repo,
+		client:    client,
+		forwarder: NewRetryForwarder(producer, historyConsumerName),
+		dedup:     dedup,
+		cfg:       cfg.WithDefault(defaultHistoryConsumerConfig),
+		l:         l,
+	}
 }
 
 // Start 用于启动消费者,开始消费和处理历史记录事件
 func (i *HistoryRecordConsumer) Start() error {
-	cg, err := sarama.NewConsumerGroupFromClient("interactive", i.client)
+	cfg := i.cfg
+	// 使用 samarax 包的 NewHandler 函数创建一个单个消息处理器,用于逐个处理消息
+	// 重试之后依旧失败的消息转发到重试 topic
+	router := samarax.NewRouter().
+		Handle(TopicReadEvent, samarax.NewHandler[ReadEvent](i.l, i.Consume).
+			WithCommitStrategy(cfg.CommitStrategy).
+			WithFallback(i.forwarder.ForwardOne)).
+		Handle(TopicBatchReadEvent, samarax.NewHandler[BatchReadEvent](i.l, i.ConsumeBatchEvent).
+			WithCommitStrategy(cfg.CommitStrategy).
+			WithFallback(i.forwarder.ForwardBatch))
+	err := cfg.Validate(router)
 	if err != nil {
 		return err
 	}
 
-	go func() {
-		// 使用 samarax 包的 NewHandler 函数创建一个单个消息处理器,用于逐个处理消息
-		er := cg.Consume(context.Background(),
-			[]string{TopicReadEvent},
-			samarax.NewHandler[ReadEvent](i.l, i.Consume))
-		if er != nil {
-			i.l.Error("退出消费", logger.Error(er))
-		}
-	}()
+	cg, err := sarama.NewConsumerGroupFromClient(cfg.GroupId, i.client)
+	if err != nil {
+		return err
+	}
+	go events.ConsumeLoop(cg, cfg.Topics, router, i.l)
+
+	retryCg, err := startRetryConsumer(i.client, cfg, historyConsumerName,
+		i.forwarder, i.l, i.Consume)
+	if err != nil {
+		_ = cg.Close()
+		return err
+	}
+	i.cgs = []sarama.ConsumerGroup{cg, retryCg}
+	return nil
+}
 
-	return err
+// Stop 停止消费
+func (i *HistoryRecordConsumer) Stop() error {
+	return events.CloseGroups(i.cgs...)
 }
 
 func (i *HistoryRecordConsumer) Consume(msg *sarama.ConsumerMessage, event ReadEvent) error {
+	// 别的消费者处理失败之后重放的消息
+	if !IsFor(msg, historyConsumerName) {
+		return nil
+	}
+	return i.addRecords([]ReadEvent{event})
+}
+
+// ConsumeBatchEvent 处理 SaramaBatchProducer 发送的批量阅读事件
+func (i *HistoryRecordConsumer) ConsumeBatchEvent(msg *sarama.ConsumerMessage, event BatchReadEvent) error {
+	return i.addRecords(event.Events())
+}
+
+// addRecords 丢弃处理过的事件之后逐条添加历史记录
+// 每添加成功一条就标记一条,中途失败的时候释放剩下的,重试只会处理剩下的
+// 没有登录的读者 Uid 为 0,没有浏览记录,直接标记为处理过
+func (i *HistoryRecordConsumer) addRecords(evts []ReadEvent) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 
-	// 添加一条历史记录
-	return i.repo.AddRecord(ctx, domain.HistoryRecord{
-		BizId: event.Aid,
-		Biz:   "article",
-		Uid:   event.Uid,
-	})
-
+	fresh, err := i.dedup.Claim(ctx, historyConsumerName, readEventIds(evts))
+	if err != nil {
+		return err
+	}
+	for idx, evt := range evts {
+		if !fresh[idx] {
+			continue
+		}
+		if evt.Uid <= 0 {
+			i.dedup.Mark(ctx, historyConsumerName, []int64{evt.Id})
+			continue
+		}
+		// 添加一条历史记录
+		err = i.repo.AddRecord(ctx, domain.HistoryRecord{
+			BizId: evt.Aid,
+			Biz:   "article",
+			Uid:   evt.Uid,
+		})
+		if err != nil {
+			rest := make([]int64, 0, len(evts)-idx)
+			for j := idx; j < len(evts); j++ {
+				if fresh[j] {
+					rest = append(rest, evts[j].Id)
+				}
+			}
+			i.dedup.Release(ctx, historyConsumerName, rest)
+			return err
+		}
+		i.dedup.Mark(ctx, historyConsumerName, []int64{evt.Id})
+	}
+	return nil
 }
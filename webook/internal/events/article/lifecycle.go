@@ -0,0 +1,185 @@
+package article
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ClearloveHn/golangwebook/webook/internal/domain"
+	"github.com/ClearloveHn/golangwebook/webook/internal/events"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/samarax"
+	"github.com/IBM/sarama"
+	"strconv"
+	"time"
+)
+
+// 文章的生命周期事件
+// 发表、修改、撤回都发送到同一个 topic,并且用文章 ID 作为 key,
+// 这样同一篇文章的事件在同一个分区里面,下游按照发生的顺序处理。
+// 搜索、feed 流、通知之类的模块实现 ArticleEventHandler,再用 ArticleEventConsumer 订阅。
+
+// TopicArticleEvent 文章生命周期事件的主题名称
+const TopicArticleEvent = "article_events"
+
+// ArticleEventType 文章生命周期事件的类型
+type ArticleEventType string
+
+const (
+	// ArticleEventPublished 第一次发表,或者撤回之后重新发表
+	ArticleEventPublished ArticleEventType = "published"
+	// ArticleEventUpdated 修改已经发表的文章
+	ArticleEventUpdated ArticleEventType = "updated"
+	// ArticleEventWithdrawn 撤回,撤回之后仅自己可见
+	ArticleEventWithdrawn ArticleEventType = "withdrawn"
+)
+
+// ArticleEvent 文章生命周期事件,时间都是毫秒数
+type ArticleEvent struct {
+	Type     ArticleEventType
+	Aid      int64
+	AuthorId int64
+	Title    string
+	Abstract string
+	Ctime    int64
+	Utime    int64
+	// OccurredAt 事件发生的时间
+	OccurredAt int64
+}
+
+// NewArticleEvent 根据文章构造生命周期事件
+func NewArticleEvent(typ ArticleEventType, art domain.Article) ArticleEvent {
+	return ArticleEvent{
+		Type:       typ,
+		Aid:        art.Id,
+		AuthorId:   art.Author.Id,
+		Title:      art.Title,
+		Abstract:   art.Abstract(),
+		Ctime:      art.Ctime.UnixMilli(),
+		Utime:      art.Utime.UnixMilli(),
+		OccurredAt: time.Now().UnixMilli(),
+	}
+}
+
+// ArticleEventProducer 发送文章生命周期事件
+type ArticleEventProducer interface {
+	ProduceArticleEvent(evt ArticleEvent) error
+}
+
+// SaramaArticleEventProducer 使用 Sarama 同步生产者发送文章生命周期事件
+type SaramaArticleEventProducer struct {
+	producer sarama.SyncProducer
+}
+
+func NewSaramaArticleEventProducer(producer sarama.SyncProducer) ArticleEventProducer {
+	return &SaramaArticleEventProducer{producer: producer}
+}
+
+func (s *SaramaArticleEventProducer) ProduceArticleEvent(evt ArticleEvent) error {
+	val, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	_, _, err = s.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: TopicArticleEvent,
+		// 同一篇文章的事件进入同一个分区,保证顺序
+		Key:   sarama.StringEncoder(strconv.FormatInt(evt.Aid, 10)),
+		Value: sarama.ByteEncoder(val),
+	})
+	return err
+}
+
+// ArticleEventHandler 下游模块实现这个接口来处理文章生命周期事件
+// 只关心部分事件的话,可以组合 BaseArticleEventHandler
+type ArticleEventHandler interface {
+	OnPublished(ctx context.Context, evt ArticleEvent) error
+	OnUpdated(ctx context.Context, evt ArticleEvent) error
+	OnWithdrawn(ctx context.Context, evt ArticleEvent) error
+}
+
+// BaseArticleEventHandler 什么也不做的 ArticleEventHandler
+type BaseArticleEventHandler struct {
+}
+
+func (BaseArticleEventHandler) OnPublished(ctx context.Context, evt ArticleEvent) error {
+	return nil
+}
+
+func (BaseArticleEventHandler) OnUpdated(ctx context.Context, evt ArticleEvent) error {
+	return nil
+}
+
+func (BaseArticleEventHandler) OnWithdrawn(ctx context.Context, evt ArticleEvent) error {
+	return nil
+}
+
+// ArticleEventConsumer 订阅文章生命周期事件,根据事件的类型交给 ArticleEventHandler 处理
+// 每个下游模块使用自己的消费者组,所以 cfg 里面的 GroupId 是必须配置的
+type ArticleEventConsumer struct {
+	client  sarama.Client
+	cfg     events.ConsumerConfig
+	handler ArticleEventHandler
+	timeout time.Duration
+	cg      sarama.ConsumerGroup
+	l       logger.LoggerV1
+}
+
+func NewArticleEventConsumer(client sarama.Client, cfg events.ConsumerConfig,
+	handler ArticleEventHandler, l logger.LoggerV1) *ArticleEventConsumer {
+	return &ArticleEventConsumer{
+		client: client,
+		cfg: cfg.WithDefault(events.ConsumerConfig{
+			Topics:         []string{TopicArticleEvent},
+			CommitStrategy: samarax.CommitAuto,
+		}),
+		handler: handler,
+		timeout: time.Second * 3,
+		l:       l,
+	}
+}
+
+// Start 启动消费者
+func (c *ArticleEventConsumer) Start() error {
+	if c.cfg.GroupId == "" {
+		return errors.New("文章事件的消费者必须配置消费者组")
+	}
+	router := samarax.NewRouter().
+		Handle(TopicArticleEvent, samarax.NewHandler[ArticleEvent](c.l, c.Consume).
+			WithCommitStrategy(c.cfg.CommitStrategy))
+	err := c.cfg.Validate(router)
+	if err != nil {
+		return err
+	}
+	cg, err := sarama.NewConsumerGroupFromClient(c.cfg.GroupId, c.client)
+	if err != nil {
+		return err
+	}
+	c.cg = cg
+	go events.ConsumeLoop(cg, c.cfg.Topics, router, c.l)
+	return nil
+}
+
+// Stop 停止消费
+func (c *ArticleEventConsumer) Stop() error {
+	return events.CloseGroups(c.cg)
+}
+
+// Consume 根据事件的类型分发
+func (c *ArticleEventConsumer) Consume(msg *sarama.ConsumerMessage, evt ArticleEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	switch evt.Type {
+	case ArticleEventPublished:
+		return c.handler.OnPublished(ctx, evt)
+	case ArticleEventUpdated:
+		return c.handler.OnUpdated(ctx, evt)
+	case ArticleEventWithdrawn:
+		return c.handler.OnWithdrawn(ctx, evt)
+	default:
+		// 可能是新版本加的事件类型,忽略掉
+		c.l.Warn("未知的文章事件类型",
+			logger.String("type", string(evt.Type)),
+			logger.Int64("aid", evt.Aid))
+		return nil
+	}
+}
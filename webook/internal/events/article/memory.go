@@ -0,0 +1,421 @@
+package article
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
+	"github.com/IBM/sarama"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 进程内的阅读事件总线
+// 用于测试和单机部署,不需要 Kafka 也可以跑通阅读计数和历史记录。
+// 每个 MemoryConsumer 相当于一个消费者组,都会收到全部的阅读事件,
+// 处理成功之后才算确认,失败了会一直重试(或者重试到上限之后进入死信),
+// Stop 的时候没有确认的消息会留在队列里面,下一次 Start 之后重新投递,所以是至少一次的语义。
+// 和 Kafka 一样,消费者需要自己保证幂等。
+
+var ErrMemoryBusClosed = errors.New("事件总线已经关闭")
+
+// memoryMessage 总线里面的一条消息
+type memoryMessage struct {
+	msg *sarama.ConsumerMessage
+	evt ReadEvent
+	// attempts 已经投递的次数
+	attempts int
+}
+
+// memoryQueue 一个消费者的待处理队列
+type memoryQueue struct {
+	mu     sync.Mutex
+	msgs   []*memoryMessage
+	notify chan struct{}
+	// inflight 正在处理,还没有确认的消息数量
+	inflight int
+}
+
+func newMemoryQueue() *memoryQueue {
+	return &memoryQueue{notify: make(chan struct{}, 1)}
+}
+
+func (q *memoryQueue) push(msg *memoryMessage) {
+	q.mu.Lock()
+	q.msgs = append(q.msgs, msg)
+	q.mu.Unlock()
+	q.signal()
+}
+
+// pushFront 把没有确认的消息放回队列头部,保证重新投递的顺序
+func (q *memoryQueue) pushFront(msgs []*memoryMessage) {
+	q.mu.Lock()
+	q.msgs = append(append([]*memoryMessage{}, msgs...), q.msgs...)
+	q.inflight -= len(msgs)
+	q.mu.Unlock()
+	q.signal()
+}
+
+// take 最多取出 n 条消息
+func (q *memoryQueue) take(n int) []*memoryMessage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n = min(n, len(q.msgs))
+	res := q.msgs[:n:n]
+	q.msgs = q.msgs[n:]
+	q.inflight += n
+	return res
+}
+
+func (q *memoryQueue) ack(n int) {
+	q.mu.Lock()
+	q.inflight -= n
+	q.mu.Unlock()
+}
+
+// pending 还没有确认的消息数量,包括正在处理的
+func (q *memoryQueue) pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.msgs) + q.inflight
+}
+
+func (q *memoryQueue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// MemoryBus 进程内的 Producer 实现
+type MemoryBus struct {
+	mu     sync.RWMutex
+	queues map[string]*memoryQueue
+	offset int64
+	closed bool
+	// failure 模拟发送失败,返回 error 的时候消息不会进入总线
+	failure func(evt ReadEvent) error
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{queues: make(map[string]*memoryQueue)}
+}
+
+// WithProduceFailure 设置发送失败的模拟
+func (b *MemoryBus) WithProduceFailure(fn func(evt ReadEvent) error) *MemoryBus {
+	b.failure = fn
+	return b
+}
+
+// ProduceReadEvent 把事件投递给所有的消费者
+func (b *MemoryBus) ProduceReadEvent(evt ReadEvent) error {
+	if b.failure != nil {
+		if err := b.failure(evt); err != nil {
+			return err
+		}
+	}
+	val, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return ErrMemoryBusClosed
+	}
+	offset := atomic.AddInt64(&b.offset, 1) - 1
+	now := time.Now()
+	for _, q := range b.queues {
+		// 每个消费者一份,避免消费者修改消息之后互相影响
+		q.push(&memoryMessage{
+			msg: &sarama.ConsumerMessage{
+				Topic:     TopicReadEvent,
+				Key:       []byte(strconv.FormatInt(evt.Aid, 10)),
+				Value:     append([]byte(nil), val...),
+				Offset:    offset,
+				Timestamp: now,
+			},
+			evt: evt,
+		})
+	}
+	return nil
+}
+
+// Pending 还没有被 name 这个消费者确认的消息数量
+func (b *MemoryBus) Pending(name string) int {
+	b.mu.RLock()
+	q, ok := b.queues[name]
+	b.mu.RUnlock()
+	if !ok {
+		return 0
+	}
+	return q.pending()
+}
+
+// WaitIdle 等到所有的消息都被确认,或者 ctx 结束,测试里面用来等待异步处理完成
+func (b *MemoryBus) WaitIdle(ctx context.Context) error {
+	ticker := time.NewTicker(time.Millisecond * 10)
+	defer ticker.Stop()
+	for {
+		if b.idle() {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (b *MemoryBus) idle() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, q := range b.queues {
+		if q.pending() > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Close 关闭之后不能再发送消息,已经在队列里面的消息依旧可以被消费
+func (b *MemoryBus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	return nil
+}
+
+// subscribe 同名的消费者共用一个队列,相当于 Kafka 里面的同一个消费者组
+func (b *MemoryBus) subscribe(name string) *memoryQueue {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	q, ok := b.queues[name]
+	if !ok {
+		q = newMemoryQueue()
+		b.queues[name] = q
+	}
+	return q
+}
+
+// MemoryConsumer 从 MemoryBus 消费阅读事件,交给和 Kafka 消费者一样的处理方法
+// 实现了 events.Consumer,可以注册到 events.Registry 里面
+type MemoryConsumer struct {
+	name  string
+	queue *memoryQueue
+	fn    func(msgs []*sarama.ConsumerMessage, evts []ReadEvent) error
+
+	batchSize     int
+	batchDuration time.Duration
+	retryInterval time.Duration
+	// maxAttempts 最多投递的次数,0 表示一直重试直到成功
+	maxAttempts int
+	// failure 模拟处理失败,在调用处理方法之前执行
+	failure func(msgs []*sarama.ConsumerMessage) error
+
+	mu          sync.Mutex
+	deadLetters []ReadEvent
+	cancel      context.CancelFunc
+	done        chan struct{}
+	l           logger.LoggerV1
+}
+
+// NewMemoryConsumer 逐条处理,例如传入 InteractiveReadEventConsumer.Consume 或者 HistoryRecordConsumer.Consume
+// 创建的时候就订阅了,所以 Start 之前发送的消息也不会丢
+func NewMemoryConsumer(bus *MemoryBus, name string,
+	fn func(msg *sarama.ConsumerMessage, evt ReadEvent) error, l logger.LoggerV1) *MemoryConsumer {
+	return newMemoryConsumer(bus, name, func(msgs []*sarama.ConsumerMessage, evts []ReadEvent) error {
+		return fn(msgs[0], evts[0])
+	}, 1, l)
+}
+
+// NewMemoryBatchConsumer 批量处理,例如传入 InteractiveReadEventConsumer.BatchConsume
+func NewMemoryBatchConsumer(bus *MemoryBus, name string,
+	fn func(msgs []*sarama.ConsumerMessage, evts []ReadEvent) error, l logger.LoggerV1) *MemoryConsumer {
+	return newMemoryConsumer(bus, name, fn, 10, l)
+}
+
+func newMemoryConsumer(bus *MemoryBus, name string,
+	fn func(msgs []*sarama.ConsumerMessage, evts []ReadEvent) error,
+	batchSize int, l logger.LoggerV1) *MemoryConsumer {
+	return &MemoryConsumer{
+		name:          name,
+		queue:         bus.subscribe(name),
+		fn:            fn,
+		batchSize:     batchSize,
+		batchDuration: time.Millisecond * 100,
+		retryInterval: time.Millisecond * 100,
+		l:             l,
+	}
+}
+
+// WithBatchSize 只对批量处理生效
+func (c *MemoryConsumer) WithBatchSize(size int) *MemoryConsumer {
+	if size > 0 && c.batchSize > 1 {
+		c.batchSize = size
+	}
+	return c
+}
+
+// WithBatchDuration 凑不够一批的时候最多等待多久
+func (c *MemoryConsumer) WithBatchDuration(d time.Duration) *MemoryConsumer {
+	c.batchDuration = d
+	return c
+}
+
+// WithRetry 设置重试的间隔和最多投递的次数,超过次数之后进入死信
+func (c *MemoryConsumer) WithRetry(interval time.Duration, maxAttempts int) *MemoryConsumer {
+	c.retryInterval = interval
+	c.maxAttempts = maxAttempts
+	return c
+}
+
+// WithFailure 设置处理失败的模拟,可以配合 FailTimes 使用
+func (c *MemoryConsumer) WithFailure(fn func(msgs []*sarama.ConsumerMessage) error) *MemoryConsumer {
+	c.failure = fn
+	return c
+}
+
+// DeadLetters 超过最多投递次数之后被放弃的事件
+func (c *MemoryConsumer) DeadLetters() []ReadEvent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]ReadEvent{}, c.deadLetters...)
+}
+
+// Start 启动消费,重复调用不会启动多个协程
+func (c *MemoryConsumer) Start() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancel != nil {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.done = make(chan struct{})
+	go c.loop(ctx, c.done)
+	return nil
+}
+
+// Stop 等待正在处理的消息处理完,没有确认的消息留在队列里面
+func (c *MemoryConsumer) Stop() error {
+	c.mu.Lock()
+	cancel, done := c.cancel, c.done
+	c.cancel, c.done = nil, nil
+	c.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	<-done
+	return nil
+}
+
+func (c *MemoryConsumer) loop(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	for {
+		batch := c.collect(ctx)
+		if len(batch) > 0 {
+			c.deliver(ctx, batch)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// collect 凑够一批或者等待超时之后返回,至少有一条消息才开始计时
+func (c *MemoryConsumer) collect(ctx context.Context) []*memoryMessage {
+	var batch []*memoryMessage
+	var timeout <-chan time.Time
+	for {
+		batch = append(batch, c.queue.take(c.batchSize-len(batch))...)
+		if len(batch) >= c.batchSize {
+			return batch
+		}
+		if len(batch) > 0 && timeout == nil {
+			timer := time.NewTimer(c.batchDuration)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case <-c.queue.notify:
+		case <-timeout:
+			return batch
+		case <-ctx.Done():
+			// 已经取出来的消息还给队列
+			if len(batch) > 0 {
+				c.queue.pushFront(batch)
+			}
+			return nil
+		}
+	}
+}
+
+// deliver 处理一批消息,失败了就重试,直到成功、进入死信或者停止消费
+func (c *MemoryConsumer) deliver(ctx context.Context, batch []*memoryMessage) {
+	msgs := make([]*sarama.ConsumerMessage, 0, len(batch))
+	evts := make([]ReadEvent, 0, len(batch))
+	for _, m := range batch {
+		msgs = append(msgs, m.msg)
+		evts = append(evts, m.evt)
+	}
+
+	for {
+		for _, m := range batch {
+			m.attempts++
+		}
+		err := c.handle(msgs, evts)
+		if err == nil {
+			c.queue.ack(len(batch))
+			return
+		}
+		c.l.Error("处理阅读事件失败",
+			logger.String("consumer", c.name),
+			logger.Int("size", len(batch)),
+			logger.Int("attempts", batch[0].attempts),
+			logger.Error(err))
+
+		if c.maxAttempts > 0 && batch[0].attempts >= c.maxAttempts {
+			c.mu.Lock()
+			c.deadLetters = append(c.deadLetters, evts...)
+			c.mu.Unlock()
+			c.queue.ack(len(batch))
+			return
+		}
+
+		timer := time.NewTimer(c.retryInterval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			// 没有确认,下次启动的时候重新投递
+			c.queue.pushFront(batch)
+			return
+		}
+	}
+}
+
+func (c *MemoryConsumer) handle(msgs []*sarama.ConsumerMessage, evts []ReadEvent) error {
+	if c.failure != nil {
+		if err := c.failure(msgs); err != nil {
+			return err
+		}
+	}
+	return c.fn(msgs, evts)
+}
+
+// FailTimes 前 n 次调用返回 err,之后都返回 nil,用于模拟短暂的故障
+func FailTimes(n int, err error) func(msgs []*sarama.ConsumerMessage) error {
+	var cnt int64
+	return func(msgs []*sarama.ConsumerMessage) error {
+		if atomic.AddInt64(&cnt, 1) <= int64(n) {
+			return err
+		}
+		return nil
+	}
+}
@@ -0,0 +1,388 @@
+package article
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ClearloveHn/golangwebook/webook/internal/events"
+	"github.com/ClearloveHn/golangwebook/webook/internal/repository"
+	"github.com/ClearloveHn/golangwebook/webook/internal/repository/cache"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
+	"github.com/IBM/sarama"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var errMockFailure = errors.New("模拟的故障")
+
+// mockInteractiveRepo 只记录阅读数,前 failTimes 次调用返回错误
+type mockInteractiveRepo struct {
+	repository.InteractiveRepository
+	failTimes int64
+
+	mu       sync.Mutex
+	readCnts map[int64]int
+	rawCnts  map[int64]int
+}
+
+func newMockInteractiveRepo(failTimes int64) *mockInteractiveRepo {
+	return &mockInteractiveRepo{
+		failTimes: failTimes,
+		readCnts:  make(map[int64]int),
+		rawCnts:   make(map[int64]int),
+	}
+}
+
+func (r *mockInteractiveRepo) BatchIncrReadCnt(ctx context.Context, biz []string, bizId []int64) error {
+	return r.incr(r.readCnts, bizId)
+}
+
+func (r *mockInteractiveRepo) BatchIncrRawReadCnt(ctx context.Context, biz []string, bizId []int64) error {
+	return r.incr(r.rawCnts, bizId)
+}
+
+func (r *mockInteractiveRepo) incr(cnts map[int64]int, bizId []int64) error {
+	if atomic.AddInt64(&r.failTimes, -1) >= 0 {
+		return errMockFailure
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range bizId {
+		cnts[id]++
+	}
+	return nil
+}
+
+func (r *mockInteractiveRepo) total() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := 0
+	for _, cnt := range r.readCnts {
+		res += cnt
+	}
+	return res
+}
+
+// mockEventDedupCache 内存版本的去重记录,语义和 RedisEventDedupCache 一致
+type mockEventDedupCache struct {
+	mu     sync.Mutex
+	status map[string]string
+}
+
+func newMockEventDedupCache() *mockEventDedupCache {
+	return &mockEventDedupCache{status: make(map[string]string)}
+}
+
+func (c *mockEventDedupCache) Claim(ctx context.Context, consumer string, ids []int64) ([]cache.EventClaim, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	res := make([]cache.EventClaim, len(ids))
+	for i, id := range ids {
+		key := c.key(consumer, id)
+		switch c.status[key] {
+		case "":
+			c.status[key] = "processing"
+			res[i] = cache.EventClaimed
+		case "done":
+			res[i] = cache.EventDone
+		default:
+			res[i] = cache.EventInFlight
+		}
+	}
+	return res, nil
+}
+
+func (c *mockEventDedupCache) Mark(ctx context.Context, consumer string, ids []int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, id := range ids {
+		c.status[c.key(consumer, id)] = "done"
+	}
+	return nil
+}
+
+func (c *mockEventDedupCache) Release(ctx context.Context, consumer string, ids []int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, id := range ids {
+		key := c.key(consumer, id)
+		if c.status[key] == "processing" {
+			delete(c.status, key)
+		}
+	}
+	return nil
+}
+
+func (c *mockEventDedupCache) key(consumer string, id int64) string {
+	return fmt.Sprintf("%s:%d", consumer, id)
+}
+
+func newTestReadConsumer(t *testing.T, repo repository.InteractiveRepository) *InteractiveReadEventConsumer {
+	return newTestReadConsumerWithCache(t, repo, newMockEventDedupCache())
+}
+
+func newTestReadConsumerWithCache(t *testing.T, repo repository.InteractiveRepository,
+	dedupCache cache.EventDedupCache) *InteractiveReadEventConsumer {
+	l := logger.NewNopLogger()
+	dedup, err := events.NewDeduplicator(dedupCache, prometheus.CounterOpts{
+		Namespace: "webook",
+		Subsystem: "test",
+		Name:      "dropped_duplicate_events",
+	}, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	window := NewReadWindowPolicy(nil, ReadWindowConfig{}, l)
+	return NewInteractiveReadEventConsumer(repo, nil, nil, dedup, window, events.ConsumerConfig{}, l)
+}
+
+func waitIdle(t *testing.T, bus *MemoryBus) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := bus.WaitIdle(ctx); err != nil {
+		t.Fatalf("等待消费完成超时, %v", err)
+	}
+}
+
+func produce(t *testing.T, bus *MemoryBus, evts ...ReadEvent) {
+	for _, evt := range evts {
+		if err := bus.ProduceReadEvent(evt); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMemoryConsumer_Consume(t *testing.T) {
+	testCases := []struct {
+		name string
+		// 处理方法之前的故障
+		failTimes int
+		// 写数据库的故障
+		repoFailTimes int64
+		evts          []ReadEvent
+		wantCnts      map[int64]int
+	}{
+		{
+			name: "重复投递的事件只计数一次",
+			evts: []ReadEvent{
+				{Id: 1, Aid: 10, Uid: 100},
+				{Id: 2, Aid: 10, Uid: 101},
+				{Id: 2, Aid: 10, Uid: 101},
+				{Id: 3, Aid: 11, Uid: 100},
+			},
+			wantCnts: map[int64]int{10: 2, 11: 1},
+		},
+		{
+			name:      "处理失败之后重新投递",
+			failTimes: 3,
+			evts: []ReadEvent{
+				{Id: 1, Aid: 10, Uid: 100},
+				{Id: 2, Aid: 11, Uid: 100},
+			},
+			wantCnts: map[int64]int{10: 1, 11: 1},
+		},
+		{
+			name:          "写数据库失败之后释放事件,重试的时候依旧计数",
+			repoFailTimes: 2,
+			evts: []ReadEvent{
+				{Id: 1, Aid: 10, Uid: 100},
+				{Id: 1, Aid: 10, Uid: 100},
+				{Id: 2, Aid: 11, Uid: 100},
+			},
+			wantCnts: map[int64]int{10: 1, 11: 1},
+		},
+		{
+			name: "没有 Id 的旧事件没法去重",
+			evts: []ReadEvent{
+				{Aid: 10, Uid: 100},
+				{Aid: 10, Uid: 100},
+			},
+			wantCnts: map[int64]int{10: 2},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			bus := NewMemoryBus()
+			repo := newMockInteractiveRepo(tc.repoFailTimes)
+			consumer := newTestReadConsumer(t, repo)
+			mc := NewMemoryConsumer(bus, interactiveConsumerName, consumer.Consume, logger.NewNopLogger()).
+				WithFailure(FailTimes(tc.failTimes, errMockFailure)).
+				WithRetry(time.Millisecond, 0)
+			if err := mc.Start(); err != nil {
+				t.Fatal(err)
+			}
+			defer mc.Stop()
+
+			produce(t, bus, tc.evts...)
+			waitIdle(t, bus)
+
+			assertCnts(t, tc.wantCnts, repo)
+			if len(mc.DeadLetters()) != 0 {
+				t.Fatalf("不应该有死信, %v", mc.DeadLetters())
+			}
+		})
+	}
+}
+
+func TestMemoryConsumer_BatchConsume(t *testing.T) {
+	bus := NewMemoryBus()
+	// 第一批写数据库失败,整批重新投递
+	repo := newMockInteractiveRepo(1)
+	consumer := newTestReadConsumer(t, repo)
+	mc := NewMemoryBatchConsumer(bus, interactiveConsumerName, consumer.BatchConsume, logger.NewNopLogger()).
+		WithBatchSize(4).
+		WithBatchDuration(time.Millisecond*10).
+		WithFailure(FailTimes(1, errMockFailure)).
+		WithRetry(time.Millisecond, 0)
+
+	var evts []ReadEvent
+	wantCnts := make(map[int64]int)
+	for i := int64(1); i <= 10; i++ {
+		aid := i%3 + 1
+		evts = append(evts, ReadEvent{Id: i, Aid: aid, Uid: i})
+		wantCnts[aid]++
+	}
+	// 同一批里面重复的和跨批次重复的
+	evts = append(evts, ReadEvent{Id: 1, Aid: 2, Uid: 1}, ReadEvent{Id: 10, Aid: 2, Uid: 10})
+	// Start 之前发送的消息也不会丢
+	produce(t, bus, evts...)
+	if err := mc.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer mc.Stop()
+	waitIdle(t, bus)
+
+	assertCnts(t, wantCnts, repo)
+	if repo.total() != 10 {
+		t.Fatalf("阅读数总数不对, 期望 10, 实际 %d", repo.total())
+	}
+}
+
+func TestMemoryConsumer_RedeliverAfterStop(t *testing.T) {
+	bus := NewMemoryBus()
+	repo := newMockInteractiveRepo(0)
+	consumer := newTestReadConsumer(t, repo)
+
+	var broken int64 = 1
+	var attempts int64
+	mc := NewMemoryConsumer(bus, interactiveConsumerName, consumer.Consume, logger.NewNopLogger()).
+		WithFailure(func(msgs []*sarama.ConsumerMessage) error {
+			atomic.AddInt64(&attempts, 1)
+			if atomic.LoadInt64(&broken) == 1 {
+				return errMockFailure
+			}
+			return nil
+		}).
+		WithRetry(time.Millisecond, 0)
+	if err := mc.Start(); err != nil {
+		t.Fatal(err)
+	}
+	produce(t, bus, ReadEvent{Id: 1, Aid: 10, Uid: 100}, ReadEvent{Id: 2, Aid: 11, Uid: 100})
+
+	// 至少投递过一次之后再停止
+	deadline := time.Now().Add(time.Second * 5)
+	for atomic.LoadInt64(&attempts) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("消息一直没有被投递")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := mc.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if pending := bus.Pending(interactiveConsumerName); pending != 2 {
+		t.Fatalf("没有确认的消息应该留在队列里面, 期望 2, 实际 %d", pending)
+	}
+	assertCnts(t, map[int64]int{}, repo)
+
+	// 恢复之后重新启动,留在队列里面的消息重新投递
+	atomic.StoreInt64(&broken, 0)
+	if err := mc.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer mc.Stop()
+	waitIdle(t, bus)
+	assertCnts(t, map[int64]int{10: 1, 11: 1}, repo)
+}
+
+func TestMemoryConsumer_InFlight(t *testing.T) {
+	bus := NewMemoryBus()
+	repo := newMockInteractiveRepo(0)
+	dedupCache := newMockEventDedupCache()
+	// 别的消费者占住了事件 1,还没有处理完
+	key := dedupCache.key(interactiveConsumerName, 1)
+	dedupCache.status[key] = "processing"
+	consumer := newTestReadConsumerWithCache(t, repo, dedupCache)
+
+	var attempts int64
+	mc := NewMemoryConsumer(bus, interactiveConsumerName, func(msg *sarama.ConsumerMessage, evt ReadEvent) error {
+		atomic.AddInt64(&attempts, 1)
+		return consumer.Consume(msg, evt)
+	}, logger.NewNopLogger()).WithRetry(time.Millisecond, 0)
+	if err := mc.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer mc.Stop()
+	produce(t, bus, ReadEvent{Id: 1, Aid: 10, Uid: 100})
+
+	// 正在处理中的事件不能丢,要一直重试
+	deadline := time.Now().Add(time.Second * 5)
+	for atomic.LoadInt64(&attempts) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("正在处理中的事件没有重试")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	assertCnts(t, map[int64]int{}, repo)
+
+	// 对方处理失败之后释放掉,重试的时候就能处理了
+	if err := dedupCache.Release(context.Background(), interactiveConsumerName, []int64{1}); err != nil {
+		t.Fatal(err)
+	}
+	waitIdle(t, bus)
+	assertCnts(t, map[int64]int{10: 1}, repo)
+}
+
+func TestMemoryConsumer_DeadLetters(t *testing.T) {
+	bus := NewMemoryBus()
+	repo := newMockInteractiveRepo(0)
+	consumer := newTestReadConsumer(t, repo)
+	mc := NewMemoryConsumer(bus, interactiveConsumerName, consumer.Consume, logger.NewNopLogger()).
+		WithFailure(func(msgs []*sarama.ConsumerMessage) error {
+			return errMockFailure
+		}).
+		WithRetry(time.Millisecond, 3)
+	if err := mc.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer mc.Stop()
+
+	evt := ReadEvent{Id: 1, Aid: 10, Uid: 100}
+	produce(t, bus, evt)
+	waitIdle(t, bus)
+
+	dls := mc.DeadLetters()
+	if len(dls) != 1 || dls[0] != evt {
+		t.Fatalf("超过最多投递次数之后应该进入死信, 实际 %v", dls)
+	}
+	assertCnts(t, map[int64]int{}, repo)
+}
+
+func assertCnts(t *testing.T, want map[int64]int, repo *mockInteractiveRepo) {
+	t.Helper()
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if len(want) != len(repo.readCnts) {
+		t.Fatalf("阅读数不对, 期望 %v, 实际 %v", want, repo.readCnts)
+	}
+	for aid, cnt := range want {
+		if repo.readCnts[aid] != cnt {
+			t.Fatalf("阅读数不对, 期望 %v, 实际 %v", want, repo.readCnts)
+		}
+	}
+}
@@ -8,6 +8,9 @@ import (
 // TopicReadEvent 是一个常量,表示文章阅读事件的主题名称
 const TopicReadEvent = "article_read"
 
+// TopicBatchReadEvent 批量文章阅读事件的主题名称,消息的内容是 BatchReadEvent
+const TopicBatchReadEvent = "article_read_batch"
+
 // Producer 是一个接口,定义了生产阅读事件的方法
 type Producer interface {
 	ProduceReadEvent(evt ReadEvent) error
@@ -15,14 +18,72 @@ type Producer interface {
 
 // ReadEvent 单个文章阅读事件
 type ReadEvent struct {
+	// Id 事件的唯一 ID,雪花算法生成,消费者用来去重
+	// 为 0 的是引入 Id 之前发送的事件
+	Id  int64
 	Aid int64
+	// Uid 为 0 的是匿名读者
 	Uid int64
+	// Visitor 匿名读者的标识,由 IP 和 User-Agent 计算出来,用于阅读数的去重
+	Visitor string `json:",omitempty"`
 }
 
 // BatchReadEvent 批量文章阅读事件
+// Ids、Aids 和 Uids 一一对应,第 i 个事件就是 Ids[i]、Aids[i] 和 Uids[i]
 type BatchReadEvent struct {
+	Ids  []int64
 	Aids []int64
 	Uids []int64
+	// Visitors 只有匿名读者才有值,长度和 Aids 一致
+	Visitors []string `json:",omitempty"`
+}
+
+// NewBatchReadEvent 把多个阅读事件合并成一个批量事件
+func NewBatchReadEvent(evts []ReadEvent) BatchReadEvent {
+	res := BatchReadEvent{
+		Ids:  make([]int64, 0, len(evts)),
+		Aids: make([]int64, 0, len(evts)),
+		Uids: make([]int64, 0, len(evts)),
+	}
+	for i, evt := range evts {
+		if evt.Visitor != "" && res.Visitors == nil {
+			res.Visitors = make([]string, len(evts))
+		}
+		if res.Visitors != nil {
+			res.Visitors[i] = evt.Visitor
+		}
+		res.Ids = append(res.Ids, evt.Id)
+		res.Aids = append(res.Aids, evt.Aid)
+		res.Uids = append(res.Uids, evt.Uid)
+	}
+	return res
+}
+
+// Events 把批量事件拆成单个的阅读事件
+// 引入 Id 之前发送的批量事件没有 Ids,拆出来的事件 Id 为 0
+func (b BatchReadEvent) Events() []ReadEvent {
+	cnt := min(len(b.Aids), len(b.Uids))
+	res := make([]ReadEvent, 0, cnt)
+	for i := 0; i < cnt; i++ {
+		evt := ReadEvent{Aid: b.Aids[i], Uid: b.Uids[i]}
+		if i < len(b.Ids) {
+			evt.Id = b.Ids[i]
+		}
+		if i < len(b.Visitors) {
+			evt.Visitor = b.Visitors[i]
+		}
+		res = append(res, evt)
+	}
+	return res
+}
+
+// readEventIds 取出事件的 Id,用于去重
+func readEventIds(evts []ReadEvent) []int64 {
+	ids := make([]int64, 0, len(evts))
+	for _, evt := range evts {
+		ids = append(ids, evt.Id)
+	}
+	return ids
 }
 
 // SaramaSyncProducer 使用Sarama同步生产者的阅读事件生产者
@@ -0,0 +1,86 @@
+package article
+
+import (
+	"context"
+	"github.com/ClearloveHn/golangwebook/webook/internal/repository/cache"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
+	"strconv"
+	"time"
+)
+
+// ReadWindowConfig 阅读数的去重窗口
+type ReadWindowConfig struct {
+	// Window 同一个读者在这个时间内反复阅读同一篇文章只算一次,0 表示不去重
+	Window time.Duration `yaml:"window"`
+}
+
+// ReadWindowPolicy 决定一次阅读算不算进阅读数
+// 不算的阅读依旧会计入原始阅读数,方便分析
+type ReadWindowPolicy struct {
+	cache  cache.ReadWindowCache
+	window time.Duration
+	l      logger.LoggerV1
+}
+
+func NewReadWindowPolicy(cache cache.ReadWindowCache, cfg ReadWindowConfig,
+	l logger.LoggerV1) *ReadWindowPolicy {
+	return &ReadWindowPolicy{cache: cache, window: cfg.Window, l: l}
+}
+
+// Filter 返回和 evts 一一对应的结果,true 表示要计入阅读数
+// Redis 出错的时候全部计入,宁可多算也不要卡住消费
+func (p *ReadWindowPolicy) Filter(ctx context.Context, biz string, evts []ReadEvent) []bool {
+	res := make([]bool, len(evts))
+	for i := range res {
+		res[i] = true
+	}
+	if p.window <= 0 {
+		return res
+	}
+
+	reads := make([]cache.ReadWindow, 0, len(evts))
+	idxs := make([]int, 0, len(evts))
+	for i, evt := range evts {
+		reader := evt.reader()
+		// 识别不了读者的没法去重
+		if reader == "" {
+			continue
+		}
+		eventId := evt.Id
+		if eventId == 0 {
+			// 没有事件 ID 的旧事件,随便给一个不会重复的值
+			eventId = -time.Now().UnixNano() - int64(i)
+		}
+		reads = append(reads, cache.ReadWindow{
+			EventId: eventId,
+			Biz:     biz,
+			BizId:   evt.Aid,
+			Reader:  reader,
+		})
+		idxs = append(idxs, i)
+	}
+	if len(reads) == 0 {
+		return res
+	}
+
+	first, err := p.cache.FirstRead(ctx, reads, p.window)
+	if err != nil {
+		p.l.Error("查询阅读去重窗口失败,不去重", logger.Error(err))
+		return res
+	}
+	for i, idx := range idxs {
+		res[idx] = first[i]
+	}
+	return res
+}
+
+// reader 登录用户用 uid,匿名用户用 Visitor
+func (evt ReadEvent) reader() string {
+	if evt.Uid > 0 {
+		return "u:" + strconv.FormatInt(evt.Uid, 10)
+	}
+	if evt.Visitor != "" {
+		return "v:" + evt.Visitor
+	}
+	return ""
+}
@@ -0,0 +1,150 @@
+package article
+
+import (
+	"encoding/json"
+	"github.com/ClearloveHn/golangwebook/webook/internal/events"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/samarax"
+	"github.com/IBM/sarama"
+	"time"
+)
+
+// 阅读事件的重试
+// 消费者处理失败(包括重试)之后,消息会被转发到 article_read_retry_1m,
+// 一分钟之后再处理,依旧失败就转发到 article_read_retry_10m,十分钟之后再处理,
+// 最后还是失败就进入死信 topic article_read_dlq,等待人工处理之后通过 DLQReplayer 重放。
+// 多个消费者共用这些 topic,转发的时候会在消息头里面带上消费者的名字,
+// 只有对应的消费者才会处理,其它消费者直接跳过。
+
+const (
+	TopicReadEventRetry1m  = "article_read_retry_1m"
+	TopicReadEventRetry10m = "article_read_retry_10m"
+	TopicReadEventDLQ      = "article_read_dlq"
+)
+
+const (
+	// HeaderConsumer 消息只给这个消费者处理,没有这个头的消息所有消费者都要处理
+	HeaderConsumer = "x-consumer"
+	// HeaderError 最后一次处理失败的原因,方便排查
+	HeaderError = "x-error"
+)
+
+// readEventRetryDelays 每一级重试 topic 的延迟
+var readEventRetryDelays = map[string]time.Duration{
+	TopicReadEventRetry1m:  time.Minute,
+	TopicReadEventRetry10m: time.Minute * 10,
+}
+
+// nextTopic 处理失败之后转发到哪一个 topic
+func nextTopic(topic string) string {
+	switch topic {
+	case TopicReadEvent, TopicBatchReadEvent:
+		return TopicReadEventRetry1m
+	case TopicReadEventRetry1m:
+		return TopicReadEventRetry10m
+	default:
+		return TopicReadEventDLQ
+	}
+}
+
+// IsFor 判断消息是不是给 consumer 处理的
+func IsFor(msg *sarama.ConsumerMessage, consumer string) bool {
+	c := header(msg, HeaderConsumer)
+	return c == "" || c == consumer
+}
+
+// RetryForwarder 把处理失败的阅读事件转发到下一级重试 topic 或者死信 topic
+type RetryForwarder struct {
+	producer sarama.SyncProducer
+	consumer string
+}
+
+func NewRetryForwarder(producer sarama.SyncProducer, consumer string) *RetryForwarder {
+	return &RetryForwarder{producer: producer, consumer: consumer}
+}
+
+// Forward 转发一批处理失败的消息,不是给自己处理的消息会被忽略
+func (f *RetryForwarder) Forward(msgs []*sarama.ConsumerMessage, cause error) error {
+	pms := make([]*sarama.ProducerMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		if !IsFor(msg, f.consumer) {
+			continue
+		}
+		pms = append(pms, f.retryMessage(nextTopic(msg.Topic), msg.Key, msg.Value, cause))
+	}
+	return f.send(pms)
+}
+
+// ForwardBatch 转发一条处理失败的批量阅读事件
+// 重试 topic 里面都是单个的阅读事件,所以要拆开之后再转发
+func (f *RetryForwarder) ForwardBatch(msg *sarama.ConsumerMessage, cause error) error {
+	var be BatchReadEvent
+	err := json.Unmarshal(msg.Value, &be)
+	if err != nil {
+		return err
+	}
+	evts := be.Events()
+	pms := make([]*sarama.ProducerMessage, 0, len(evts))
+	for _, evt := range evts {
+		val, err := json.Marshal(evt)
+		if err != nil {
+			return err
+		}
+		pms = append(pms, f.retryMessage(nextTopic(msg.Topic), msg.Key, val, cause))
+	}
+	return f.send(pms)
+}
+
+func (f *RetryForwarder) retryMessage(topic string, key, val []byte, cause error) *sarama.ProducerMessage {
+	pm := &sarama.ProducerMessage{
+		Topic: topic,
+		Value: sarama.ByteEncoder(val),
+		Headers: []sarama.RecordHeader{
+			{Key: []byte(HeaderConsumer), Value: []byte(f.consumer)},
+			{Key: []byte(HeaderError), Value: []byte(cause.Error())},
+		},
+		// 延迟是从这个时间开始算的
+		Timestamp: time.Now(),
+	}
+	if len(key) > 0 {
+		pm.Key = sarama.ByteEncoder(key)
+	}
+	return pm
+}
+
+func (f *RetryForwarder) send(pms []*sarama.ProducerMessage) error {
+	if len(pms) == 0 {
+		return nil
+	}
+	return f.producer.SendMessages(pms)
+}
+
+// ForwardOne 转发一条处理失败的消息
+func (f *RetryForwarder) ForwardOne(msg *sarama.ConsumerMessage, cause error) error {
+	return f.Forward([]*sarama.ConsumerMessage{msg}, cause)
+}
+
+// startRetryConsumer 启动消费重试 topic 的消费者组,消息到期之后交给 fn 处理
+// 消费者组是主消费者组加上 _retry 后缀
+func startRetryConsumer(client sarama.Client, cfg events.ConsumerConfig, consumer string,
+	forwarder *RetryForwarder, l logger.LoggerV1,
+	fn func(msg *sarama.ConsumerMessage, event ReadEvent) error) (sarama.ConsumerGroup, error) {
+	cg, err := sarama.NewConsumerGroupFromClient(cfg.GroupId+"_retry", client)
+	if err != nil {
+		return nil, err
+	}
+
+	handler := samarax.NewHandler[ReadEvent](l, func(msg *sarama.ConsumerMessage, event ReadEvent) error {
+		if !IsFor(msg, consumer) {
+			return nil
+		}
+		return fn(msg, event)
+	}).WithFallback(forwarder.ForwardOne).WithCommitStrategy(cfg.CommitStrategy)
+	topics := make([]string, 0, len(readEventRetryDelays))
+	for topic, d := range readEventRetryDelays {
+		handler.WithDelay(topic, d)
+		topics = append(topics, topic)
+	}
+	go events.ConsumeLoop(cg, topics, handler, l)
+	return cg, nil
+}
@@ -0,0 +1,51 @@
+package events
+
+import (
+	"fmt"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/samarax"
+	"time"
+)
+
+// ConsumerConfig 单个消费者的配置
+// 没有配置的字段使用消费者自己的默认值,所以配置文件里面只需要写要改的字段
+type ConsumerConfig struct {
+	// GroupId 消费者组,每个消费者必须不一样,不然会互相瓜分分区
+	GroupId string `yaml:"groupId"`
+	// Topics 订阅的 topic,只能是消费者支持的 topic 的子集
+	Topics []string `yaml:"topics"`
+	// BatchSize 和 BatchDuration 只对批量消费生效
+	BatchSize     int           `yaml:"batchSize"`
+	BatchDuration time.Duration `yaml:"batchDuration"`
+	// CommitStrategy 位移的提交策略,auto 或者 sync
+	CommitStrategy samarax.CommitStrategy `yaml:"commitStrategy"`
+}
+
+// WithDefault 用 def 补全没有配置的字段
+func (c ConsumerConfig) WithDefault(def ConsumerConfig) ConsumerConfig {
+	if c.GroupId == "" {
+		c.GroupId = def.GroupId
+	}
+	if len(c.Topics) == 0 {
+		c.Topics = def.Topics
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = def.BatchSize
+	}
+	if c.BatchDuration <= 0 {
+		c.BatchDuration = def.BatchDuration
+	}
+	if c.CommitStrategy == "" {
+		c.CommitStrategy = def.CommitStrategy
+	}
+	return c
+}
+
+// Validate 检查补全之后的配置,router 用来检查配置的 topic 是不是都有处理器
+func (c ConsumerConfig) Validate(router *samarax.Router) error {
+	switch c.CommitStrategy {
+	case samarax.CommitAuto, samarax.CommitSync:
+	default:
+		return fmt.Errorf("不支持的位移提交策略 %q", c.CommitStrategy)
+	}
+	return CheckTopics(router, c.Topics)
+}
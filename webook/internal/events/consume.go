@@ -0,0 +1,55 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/samarax"
+	"github.com/IBM/sarama"
+)
+
+// ConsumeLoop 每次再均衡之后 Consume 都会返回,所以要放在循环里面,直到消费者组关闭
+func ConsumeLoop(cg sarama.ConsumerGroup, topics []string,
+	handler sarama.ConsumerGroupHandler, l logger.LoggerV1) {
+	for {
+		er := cg.Consume(context.Background(), topics, handler)
+		if errors.Is(er, sarama.ErrClosedConsumerGroup) {
+			// 正常关闭
+			return
+		}
+		if er != nil {
+			l.Error("退出消费", logger.Error(er))
+			return
+		}
+	}
+}
+
+// CheckTopics 检查配置的 topic 是不是都有处理器
+func CheckTopics(router *samarax.Router, topics []string) error {
+	supported := make(map[string]struct{})
+	for _, topic := range router.Topics() {
+		supported[topic] = struct{}{}
+	}
+	for _, topic := range topics {
+		if _, ok := supported[topic]; !ok {
+			return fmt.Errorf("不支持的 topic %s", topic)
+		}
+	}
+	return nil
+}
+
+// CloseGroups 关闭消费者组,会等待正在处理的消息处理完
+func CloseGroups(cgs ...sarama.ConsumerGroup) error {
+	var errs []error
+	for _, cg := range cgs {
+		// 还没有启动的消费者
+		if cg == nil {
+			continue
+		}
+		if err := cg.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,140 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ClearloveHn/golangwebook/webook/internal/repository/cache"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrEventInFlight 事件正在被别的消费者处理,还不知道能不能成功,需要稍后重试
+var ErrEventInFlight = errors.New("事件正在处理中")
+
+// Deduplicator 消息重复投递的时候丢弃已经处理过的事件
+// 使用方式是先 Claim 占住事件,处理成功之后 Mark,处理失败之后 Release,
+// 并发投递的同一个事件只有一个能占到,没占到的只有在对方处理成功之后才丢弃,
+// 对方还在处理的时候返回 ErrEventInFlight 让消息重试,这样对方失败了也不会丢。
+// 去重的存储出错的时候不会阻塞消费,宁可重复处理也不要卡住,所以只打印日志。
+type Deduplicator struct {
+	cache   cache.EventDedupCache
+	dropped *prometheus.CounterVec
+	l       logger.LoggerV1
+}
+
+// NewDeduplicator opts 是丢弃的重复事件数量的指标,会按照消费者的名字分开统计
+func NewDeduplicator(cache cache.EventDedupCache, opts prometheus.CounterOpts,
+	l logger.LoggerV1) (*Deduplicator, error) {
+	dropped := prometheus.NewCounterVec(opts, []string{"consumer"})
+	if err := prometheus.Register(dropped); err != nil {
+		// 多个消费者共用同一个指标
+		var are prometheus.AlreadyRegisteredError
+		if !errors.As(err, &are) {
+			return nil, err
+		}
+		existing, ok := are.ExistingCollector.(*prometheus.CounterVec)
+		if !ok {
+			return nil, err
+		}
+		dropped = existing
+	}
+	return &Deduplicator{cache: cache, dropped: dropped, l: l}, nil
+}
+
+// Claim 返回和 ids 一一对应的结果,true 表示需要处理
+// id 为 0 的是引入事件 id 之前发送的事件,没法去重,都要处理
+// 有事件正在被别的消费者处理的时候,释放掉这一次占到的,返回 ErrEventInFlight
+func (d *Deduplicator) Claim(ctx context.Context, consumer string, ids []int64) ([]bool, error) {
+	res := make([]bool, len(ids))
+	query := make([]int64, 0, len(ids))
+	// 同一批里面也可能有重复的
+	first := make(map[int64]int, len(ids))
+	for i, id := range ids {
+		if id == 0 {
+			res[i] = true
+			continue
+		}
+		if _, ok := first[id]; ok {
+			continue
+		}
+		first[id] = i
+		query = append(query, id)
+	}
+	if len(query) > 0 {
+		claims, err := d.cache.Claim(ctx, consumer, query)
+		if err != nil {
+			d.l.Error("占用事件失败,不去重",
+				logger.String("consumer", consumer),
+				logger.Error(err))
+			claims = make([]cache.EventClaim, len(query))
+			for i := range claims {
+				claims[i] = cache.EventClaimed
+			}
+		}
+		var claimed []int64
+		var inFlight int
+		for i, id := range query {
+			switch claims[i] {
+			case cache.EventClaimed:
+				res[first[id]] = true
+				claimed = append(claimed, id)
+			case cache.EventInFlight:
+				inFlight++
+			}
+		}
+		if inFlight > 0 {
+			d.Release(ctx, consumer, claimed)
+			return nil, fmt.Errorf("%w 消费者 %s 有 %d 个事件", ErrEventInFlight, consumer, inFlight)
+		}
+	}
+
+	var dropped int
+	for _, ok := range res {
+		if !ok {
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		d.dropped.WithLabelValues(consumer).Add(float64(dropped))
+	}
+	return res, nil
+}
+
+// Mark 标记为已经处理过,失败了只是打印日志,占用过期之后重复投递的时候会重复处理
+func (d *Deduplicator) Mark(ctx context.Context, consumer string, ids []int64) {
+	marks := nonZeroIds(ids)
+	if len(marks) == 0 {
+		return
+	}
+	err := d.cache.Mark(ctx, consumer, marks)
+	if err != nil {
+		d.l.Error("标记事件已经处理过失败",
+			logger.String("consumer", consumer),
+			logger.Error(err))
+	}
+}
+
+// Release 处理失败之后释放占用,失败了只是打印日志,占用过期之后依旧可以重试
+func (d *Deduplicator) Release(ctx context.Context, consumer string, ids []int64) {
+	releases := nonZeroIds(ids)
+	if len(releases) == 0 {
+		return
+	}
+	err := d.cache.Release(ctx, consumer, releases)
+	if err != nil {
+		d.l.Error("释放事件占用失败",
+			logger.String("consumer", consumer),
+			logger.Error(err))
+	}
+}
+
+func nonZeroIds(ids []int64) []int64 {
+	res := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if id != 0 {
+			res = append(res, id)
+		}
+	}
+	return res
+}
@@ -0,0 +1,82 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
+	"sync"
+)
+
+// Registry 统一启动和停止所有的消费者
+type Registry struct {
+	mu        sync.Mutex
+	consumers []Consumer
+	started   []Consumer
+	l         logger.LoggerV1
+}
+
+func NewRegistry(l logger.LoggerV1, consumers ...Consumer) *Registry {
+	return &Registry{consumers: consumers, l: l}
+}
+
+// Register 注册消费者,需要在 Start 之前调用
+func (r *Registry) Register(c Consumer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.consumers = append(r.consumers, c)
+}
+
+// Start 启动所有的消费者,有一个启动失败就把已经启动的停掉,然后返回错误
+func (r *Registry) Start() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range r.consumers {
+		err := c.Start()
+		if err != nil {
+			r.stopStarted()
+			return err
+		}
+		r.started = append(r.started, c)
+	}
+	return nil
+}
+
+// Stop 并发停止所有的消费者,等待正在处理的消息处理完
+// ctx 超时之后不再等待,剩下的消费者在后台继续停止
+func (r *Registry) Stop(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		done <- r.stopStarted()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Registry) stopStarted() error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, c := range r.started {
+		wg.Add(1)
+		go func(c Consumer) {
+			defer wg.Done()
+			if err := c.Stop(); err != nil {
+				r.l.Error("停止消费者失败", logger.Error(err))
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}(c)
+	}
+	wg.Wait()
+	r.started = nil
+	return errors.Join(errs...)
+}
@@ -8,4 +8,6 @@ type Consumer interface {
 	// Start 是 Consumer 接口中定义的一个方法
 	//该方法用于启动事件消费者,开始消费和处理事件
 	Start() error
+	// Stop 停止消费,会等待正在处理的消息处理完并且提交位移
+	Stop() error
 }
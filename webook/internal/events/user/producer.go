@@ -0,0 +1,44 @@
+package user
+
+import (
+	"encoding/json"
+	"github.com/IBM/sarama"
+	"strconv"
+)
+
+// Producer 发送用户的生命周期事件
+type Producer interface {
+	ProduceUserCreated(evt UserCreatedEvent) error
+	ProduceUserProfileUpdated(evt UserProfileUpdatedEvent) error
+}
+
+// SaramaSyncProducer 使用 Sarama 同步生产者发送用户事件
+type SaramaSyncProducer struct {
+	producer sarama.SyncProducer
+}
+
+func NewSaramaSyncProducer(producer sarama.SyncProducer) Producer {
+	return &SaramaSyncProducer{producer: producer}
+}
+
+func (s *SaramaSyncProducer) ProduceUserCreated(evt UserCreatedEvent) error {
+	return s.produce(TopicUserCreated, evt.Uid, evt)
+}
+
+func (s *SaramaSyncProducer) ProduceUserProfileUpdated(evt UserProfileUpdatedEvent) error {
+	return s.produce(TopicUserProfileUpdated, evt.Uid, evt)
+}
+
+// produce 用用户 ID 作为 key,同一个用户的事件在同一个分区里面
+func (s *SaramaSyncProducer) produce(topic string, uid int64, evt any) error {
+	val, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	_, _, err = s.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: topic,
+		Key:   sarama.StringEncoder(strconv.FormatInt(uid, 10)),
+		Value: sarama.ByteEncoder(val),
+	})
+	return err
+}
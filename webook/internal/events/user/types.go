@@ -0,0 +1,40 @@
+package user
+
+// 用户的生命周期事件
+
+const (
+	// TopicUserCreated 用户注册的主题名称
+	TopicUserCreated = "user_created"
+	// TopicUserProfileUpdated 用户修改个人资料的主题名称
+	TopicUserProfileUpdated = "user_profile_updated"
+)
+
+// Channel 用户是通过什么方式注册的
+type Channel string
+
+const (
+	ChannelEmail  Channel = "email"
+	ChannelPhone  Channel = "phone"
+	ChannelWechat Channel = "wechat"
+)
+
+// UserCreatedEvent 用户注册事件,时间都是毫秒数
+type UserCreatedEvent struct {
+	Uid     int64
+	Channel Channel
+	// Email 和 Phone 根据注册方式,可能为空
+	Email string
+	Phone string
+	Ctime int64
+}
+
+// UserProfileUpdatedEvent 用户修改个人资料事件
+// 只有修改了的字段才有值
+type UserProfileUpdatedEvent struct {
+	Uid      int64
+	Nickname string
+	// Birthday 格式是 2006-01-02
+	Birthday string
+	AboutMe  string
+	Utime    int64
+}
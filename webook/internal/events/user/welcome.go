@@ -0,0 +1,71 @@
+package user
+
+import (
+	"context"
+	"github.com/ClearloveHn/golangwebook/webook/internal/events"
+	"github.com/ClearloveHn/golangwebook/webook/internal/service/sms"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/samarax"
+	"github.com/IBM/sarama"
+	"time"
+)
+
+// WelcomeSMSConsumer 给通过手机号注册的新用户发送欢迎短信
+type WelcomeSMSConsumer struct {
+	client sarama.Client
+	smsSvc sms.Service
+	tplId  string // 欢迎短信的模板
+	cfg    events.ConsumerConfig
+	cg     sarama.ConsumerGroup
+	l      logger.LoggerV1
+}
+
+func NewWelcomeSMSConsumer(client sarama.Client, smsSvc sms.Service,
+	tplId string, cfg events.ConsumerConfig, l logger.LoggerV1) *WelcomeSMSConsumer {
+	return &WelcomeSMSConsumer{
+		client: client,
+		smsSvc: smsSvc,
+		tplId:  tplId,
+		cfg: cfg.WithDefault(events.ConsumerConfig{
+			GroupId:        "user_welcome_sms",
+			Topics:         []string{TopicUserCreated},
+			CommitStrategy: samarax.CommitAuto,
+		}),
+		l: l,
+	}
+}
+
+// Start 启动消费者
+func (c *WelcomeSMSConsumer) Start() error {
+	// 短信发送失败重试一次就可以了,欢迎短信没有那么重要
+	router := samarax.NewRouter().
+		Handle(TopicUserCreated, samarax.NewHandler[UserCreatedEvent](c.l, c.Consume).
+			WithRetry(1, time.Second).
+			WithCommitStrategy(c.cfg.CommitStrategy))
+	err := c.cfg.Validate(router)
+	if err != nil {
+		return err
+	}
+	cg, err := sarama.NewConsumerGroupFromClient(c.cfg.GroupId, c.client)
+	if err != nil {
+		return err
+	}
+	c.cg = cg
+	go events.ConsumeLoop(cg, c.cfg.Topics, router, c.l)
+	return nil
+}
+
+// Stop 停止消费
+func (c *WelcomeSMSConsumer) Stop() error {
+	return events.CloseGroups(c.cg)
+}
+
+// Consume 没有手机号的用户直接跳过
+func (c *WelcomeSMSConsumer) Consume(msg *sarama.ConsumerMessage, evt UserCreatedEvent) error {
+	if evt.Phone == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	return c.smsSvc.Send(ctx, c.tplId, nil, evt.Phone)
+}
@@ -1,6 +1,7 @@
 package startup
 
 import (
+	"github.com/ClearloveHn/golangwebook/webook/internal/repository/dao"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
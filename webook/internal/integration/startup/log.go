@@ -1,5 +1,7 @@
 package startup
 
+import "github.com/ClearloveHn/golangwebook/webook/pkg/logger"
+
 func InitLogger() logger.LoggerV1 {
 	return logger.NewNopLogger()
 }
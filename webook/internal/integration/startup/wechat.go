@@ -1,5 +1,10 @@
 package startup
 
+import (
+	"github.com/ClearloveHn/golangwebook/webook/internal/service/oauth2/wechat"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
+)
+
 func InitWechatService(l logger.LoggerV1) wechat.Service {
-	return wechat.NewService("", "", l)
+	return wechat.NewService("", "", wechat.DefaultRedirectURL, l)
 }
@@ -1,9 +1,9 @@
 package job
 
 import (
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/robfig/cron/v3"
-	"gorm.io/gorm/logger"
 	"strconv"
 	"time"
 )
@@ -0,0 +1,71 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"github.com/ClearloveHn/golangwebook/webook/internal/service"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
+	rlock "github.com/gotomicro/redis-lock"
+	"time"
+)
+
+// InteractiveFlushJob 定期把暂存在 Redis 里面的阅读数、点赞数写回数据库
+// 多个实例同时运行的时候只有抢到分布式锁的实例会写回,避免重复计算
+type InteractiveFlushJob struct {
+	svc     service.InteractiveService
+	l       logger.LoggerV1
+	client  *rlock.Client
+	key     string
+	timeout time.Duration // 一次运行最长的时间,也是锁的过期时间
+}
+
+func NewInteractiveFlushJob(svc service.InteractiveService, l logger.LoggerV1,
+	client *rlock.Client, timeout time.Duration) *InteractiveFlushJob {
+	return &InteractiveFlushJob{
+		svc:     svc,
+		l:       l,
+		client:  client,
+		key:     "job:interactive_flush",
+		timeout: timeout,
+	}
+}
+
+func (f *InteractiveFlushJob) Name() string {
+	return "interactive_flush"
+}
+
+// Run 一直写回,直到没有暂存的增量或者超时
+func (f *InteractiveFlushJob) Run() error {
+	ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+	defer cancel()
+
+	lock, err := f.client.TryLock(ctx, f.key, f.timeout)
+	if errors.Is(err, rlock.ErrFailedToPreemptLock) {
+		// 别的实例正在写回
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		uctx, ucancel := context.WithTimeout(context.Background(), time.Second)
+		defer ucancel()
+		if er := lock.Unlock(uctx); er != nil {
+			f.l.Warn("释放分布式锁失败", logger.String("key", f.key), logger.Error(er))
+		}
+	}()
+
+	total := 0
+	for ctx.Err() == nil {
+		cnt, err := f.svc.FlushCounters(ctx)
+		total += cnt
+		if err != nil {
+			return err
+		}
+		if cnt == 0 {
+			break
+		}
+	}
+	f.l.Debug("写回交互计数", logger.Int("cnt", total))
+	return nil
+}
@@ -4,8 +4,9 @@ import (
 	"context"
 	"fmt"
 	"github.com/ClearloveHn/golangwebook/webook/internal/domain"
+	"github.com/ClearloveHn/golangwebook/webook/internal/service"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
 	"golang.org/x/sync/semaphore"
-	"gorm.io/gorm/logger"
 	"time"
 )
 
@@ -40,6 +41,14 @@ func (l *LocalFuncExecutor) RegisterFunc(name string, f func(ctx context.Context
 	l.funcs[name] = f
 }
 
+// RegisterJob 把 Job 注册成本地方法,方法名就是 Job 的名字,
+// 这样数据库里面 executor 为 local、name 相同的任务就会由 Scheduler 调度执行
+func (l *LocalFuncExecutor) RegisterJob(j Job) {
+	l.RegisterFunc(j.Name(), func(ctx context.Context, _ domain.Job) error {
+		return j.Run()
+	})
+}
+
 // Exec 方法执行任务
 func (l *LocalFuncExecutor) Exec(ctx context.Context, j domain.Job) error {
 	// 根据任务的名称获取对应的本地函数
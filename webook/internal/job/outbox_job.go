@@ -0,0 +1,70 @@
+package job
+
+import (
+	"context"
+	"github.com/ClearloveHn/golangwebook/webook/internal/service"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
+	"time"
+)
+
+// OutboxRelayJob 把 outbox 里面待发送的事件发送出去
+// 要通过 LocalFuncExecutor.RegisterJob 交给 Scheduler 调度,保证同一时刻只有一个实例在发送。
+// 不要用 CronJobBuilder,它在每个实例上都会运行,同一条事件会被重复发送
+type OutboxRelayJob struct {
+	svc     service.OutboxService
+	l       logger.LoggerV1
+	timeout time.Duration // 一次运行最长的时间
+}
+
+func NewOutboxRelayJob(svc service.OutboxService, l logger.LoggerV1, timeout time.Duration) *OutboxRelayJob {
+	return &OutboxRelayJob{svc: svc, l: l, timeout: timeout}
+}
+
+func (o *OutboxRelayJob) Name() string {
+	return "outbox_relay"
+}
+
+// Run 一批一批地发送,直到没有待发送的事件或者超时
+func (o *OutboxRelayJob) Run() error {
+	ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
+	defer cancel()
+
+	total := 0
+	for ctx.Err() == nil {
+		cnt, err := o.svc.Relay(ctx)
+		total += cnt
+		if err != nil {
+			return err
+		}
+		if cnt == 0 {
+			break
+		}
+	}
+	o.l.Debug("发送 outbox 事件", logger.Int("cnt", total))
+	return nil
+}
+
+// OutboxCleanupJob 清理 outbox 里面已经发送并且超过保留时间的事件
+// 和 OutboxRelayJob 一样交给 Scheduler 调度
+type OutboxCleanupJob struct {
+	svc     service.OutboxService
+	l       logger.LoggerV1
+	timeout time.Duration
+}
+
+func NewOutboxCleanupJob(svc service.OutboxService, l logger.LoggerV1, timeout time.Duration) *OutboxCleanupJob {
+	return &OutboxCleanupJob{svc: svc, l: l, timeout: timeout}
+}
+
+func (o *OutboxCleanupJob) Name() string {
+	return "outbox_cleanup"
+}
+
+func (o *OutboxCleanupJob) Run() error {
+	ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
+	defer cancel()
+
+	cnt, err := o.svc.Cleanup(ctx)
+	o.l.Info("清理 outbox 事件", logger.Int64("cnt", cnt))
+	return err
+}
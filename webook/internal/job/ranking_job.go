@@ -2,8 +2,9 @@ package job
 
 import (
 	"context"
+	"github.com/ClearloveHn/golangwebook/webook/internal/service"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
 	rlock "github.com/gotomicro/redis-lock"
-	"gorm.io/gorm/logger"
 	"sync"
 	"time"
 )
@@ -1,6 +1,10 @@
 package loggerxxx
 
-import "go.uber.org/zap"
+import (
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
 
 // 日志记录器
 
@@ -14,4 +18,17 @@ var CommonLogger *zap.Logger
 
 // SensitiveLogger 是一个全局的日志记录器变量
 // 它用于记录敏感的日志信息,例如用户的个人信息、关键的业务数据等
+// 打印之前会按照脱敏规则处理手机号、邮箱、验证码、token 等信息
 var SensitiveLogger *zap.Logger
+
+// Init 初始化全局的日志记录器,rules 为空的时候使用默认的脱敏规则
+func Init(l *zap.Logger, rules ...logger.MaskRule) {
+	if len(rules) == 0 {
+		rules = logger.DefaultMaskRules()
+	}
+	Logger = l
+	CommonLogger = l
+	SensitiveLogger = l.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return logger.NewMaskCore(core, rules...)
+	}))
+}
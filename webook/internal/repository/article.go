@@ -10,6 +10,9 @@ import (
 	"time"
 )
 
+// ErrArticleNotFound 文章不存在
+var ErrArticleNotFound = dao.ErrRecordNotFound
+
 //go:generate mockgen -source=./article.go -package=repomocks -destination=./mocks/article.mock.go ArticleRepository
 type ArticleRepository interface {
 	Create(ctx context.Context, art domain.Article) (int64, error)
@@ -19,6 +22,8 @@ type ArticleRepository interface {
 	GetByAuthor(ctx context.Context, uid int64, offset int, limit int) ([]domain.Article, error)
 	GetById(ctx context.Context, id int64) (domain.Article, error)
 	GetPubById(ctx context.Context, id int64) (domain.Article, error)
+	// GetPubByIds 批量获取已发布的文章,不查询作者信息,不存在的文章不会出现在结果里面
+	GetPubByIds(ctx context.Context, ids []int64) ([]domain.Article, error)
 	ListPub(ctx context.Context, start time.Time, offset int, limit int) ([]domain.Article, error)
 }
 
@@ -122,6 +127,11 @@ func (c *CachedArticleRepository) SyncStatus(ctx context.Context, uid int64, id
 		if er != nil {
 			// 也要记录日志
 		}
+		// 缓存里面的还是原来的状态
+		er = c.cache.DelPub(ctx, id)
+		if er != nil {
+			// 也要记录日志
+		}
 	}
 
 	return err
@@ -233,6 +243,21 @@ func (c *CachedArticleRepository) GetPubById(ctx context.Context, id int64) (dom
 	return res, nil
 }
 
+// GetPubByIds 批量获取已发布的文章
+func (c *CachedArticleRepository) GetPubByIds(ctx context.Context, ids []int64) ([]domain.Article, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	arts, err := c.dao.GetPubByIds(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map[dao.PublishedArticle, domain.Article](arts,
+		func(idx int, src dao.PublishedArticle) domain.Article {
+			return c.toDomain(dao.Article(src))
+		}), nil
+}
+
 // ListPub 获取已发布的文章列表
 func (c *CachedArticleRepository) ListPub(ctx context.Context, start time.Time, offset int, limit int) ([]domain.Article, error) {
 
@@ -20,6 +20,8 @@ type ArticleCache interface {
 	Set(ctx context.Context, art domain.Article) error
 	GetPub(ctx context.Context, id int64) (domain.Article, error)
 	SetPub(ctx context.Context, res domain.Article) error
+	// DelPub 撤回之后删除已发布文章的缓存,不然读者依旧能看到
+	DelPub(ctx context.Context, id int64) error
 }
 
 // ArticleRedisCache 是一个结构体，实现了 ArticleCache 接口，使用 Redis 作为缓存存储
@@ -92,7 +94,8 @@ func (a *ArticleRedisCache) Set(ctx context.Context, art domain.Article) error {
 
 // GetPub 方法用于获取某篇已发布文章的缓存
 func (a *ArticleRedisCache) GetPub(ctx context.Context, id int64) (domain.Article, error) {
-	val, err := a.client.Get(ctx, a.key(id)).Bytes()
+	// 不能和草稿共用一个键,不然读者会看到作者还没有发表的修改
+	val, err := a.client.Get(ctx, a.pubKey(id)).Bytes()
 	if err != nil {
 		return domain.Article{}, err
 	}
@@ -109,7 +112,12 @@ func (a *ArticleRedisCache) SetPub(ctx context.Context, art domain.Article) erro
 		return err
 	}
 
-	return a.client.Set(ctx, a.key(art.Id), val, 0).Err()
+	return a.client.Set(ctx, a.pubKey(art.Id), val, 0).Err()
+}
+
+// DelPub 方法用于删除某篇已发布文章的缓存
+func (a *ArticleRedisCache) DelPub(ctx context.Context, id int64) error {
+	return a.client.Del(ctx, a.pubKey(id)).Err()
 }
 
 // pubKey 方法用于生成已发布文章的缓存键
@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+var (
+	//go:embed lua/claim_event.lua
+	luaClaimEvent string
+	//go:embed lua/release_event.lua
+	luaReleaseEvent string
+)
+
+const (
+	eventProcessing = "processing"
+	eventDone       = "done"
+)
+
+// EventClaim 占用事件的结果
+type EventClaim int8
+
+const (
+	// EventInFlight 别的消费者正在处理,可能成功也可能失败,不能丢弃
+	EventInFlight EventClaim = -1
+	// EventDone 已经处理过了,可以丢弃
+	EventDone EventClaim = 0
+	// EventClaimed 占到了,需要处理
+	EventClaimed EventClaim = 1
+)
+
+// EventDedupCache 记录已经处理过的事件,用于消息重复投递的时候去重
+// 每个消费者单独记录,同一个事件可以被不同的消费者各处理一次
+// 处理之前先 Claim 占住事件,两个并发投递的同一个事件只有一个能占到;
+// 处理成功之后 Mark,处理失败之后 Release,这样重试的时候可以再次处理
+type EventDedupCache interface {
+	// Claim 返回和 ids 一一对应的结果
+	Claim(ctx context.Context, consumer string, ids []int64) ([]EventClaim, error)
+	// Mark 把事件标记为已经处理过
+	Mark(ctx context.Context, consumer string, ids []int64) error
+	// Release 放弃还没有处理成功的事件,已经标记为处理过的不受影响
+	Release(ctx context.Context, consumer string, ids []int64) error
+}
+
+// RedisEventDedupCache 每个事件一个 key,过期时间要比消息可能重复投递的时间长
+// 占住的事件在 claimExpiration 之后自动释放,避免进程崩溃之后事件再也处理不了
+type RedisEventDedupCache struct {
+	client          redis.Cmdable
+	expiration      time.Duration
+	claimExpiration time.Duration
+}
+
+func NewRedisEventDedupCache(client redis.Cmdable, expiration time.Duration) EventDedupCache {
+	return &RedisEventDedupCache{
+		client:          client,
+		expiration:      expiration,
+		claimExpiration: time.Minute,
+	}
+}
+
+// Claim 每个事件执行一次只操作一个 key 的脚本,用普通的 pipeline 发送,
+// 不同的 key 可以落在不同的 slot 上
+func (c *RedisEventDedupCache) Claim(ctx context.Context, consumer string, ids []int64) ([]EventClaim, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	cmds := make([]*redis.Cmd, 0, len(ids))
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range ids {
+			cmds = append(cmds, pipe.Eval(ctx, luaClaimEvent, []string{c.key(consumer, id)},
+				eventProcessing, eventDone, c.claimExpiration.Milliseconds()))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := make([]EventClaim, len(ids))
+	for i, cmd := range cmds {
+		val, err := cmd.Int()
+		if err != nil {
+			return nil, err
+		}
+		res[i] = EventClaim(val)
+	}
+	return res, nil
+}
+
+func (c *RedisEventDedupCache) Mark(ctx context.Context, consumer string, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	pipe := c.client.Pipeline()
+	for _, id := range ids {
+		pipe.Set(ctx, c.key(consumer, id), eventDone, c.expiration)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (c *RedisEventDedupCache) Release(ctx context.Context, consumer string, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	// 和 Claim 一样,每个 key 单独执行,避免一个脚本跨 slot
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range ids {
+			pipe.Eval(ctx, luaReleaseEvent, []string{c.key(consumer, id)}, eventProcessing)
+		}
+		return nil
+	})
+	return err
+}
+
+func (c *RedisEventDedupCache) key(consumer string, id int64) string {
+	return fmt.Sprintf("event_dedup:%s:%d", consumer, id)
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/ClearloveHn/golangwebook/webook/internal/domain"
 	"github.com/redis/go-redis/v9"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -15,17 +16,24 @@ var (
 	luaIncrCnt string
 )
 
-const fieldReadCnt = "read_cnt"       // 定义常量 fieldReadCnt,表示阅读数字段名
-const fieldLikeCnt = "like_cnt"       // 定义常量 fieldLikeCnt,表示点赞数字段名
-const fieldCollectCnt = "collect_cnt" // 定义常量 fieldCollectCnt,表示收藏数字段名
+const fieldReadCnt = "read_cnt"         // 定义常量 fieldReadCnt,表示阅读数字段名
+const fieldLikeCnt = "like_cnt"         // 定义常量 fieldLikeCnt,表示点赞数字段名
+const fieldCollectCnt = "collect_cnt"   // 定义常量 fieldCollectCnt,表示收藏数字段名
+const fieldReactionPrefix = "reaction:" // 表态数的字段名前缀,后面跟着表态的名字
 
 type InteractiveCache interface { // 定义 InteractiveCache 接口,包含交互数据缓存的相关操作
 	IncrReadCntIfPresent(ctx context.Context, biz string, bizId int64) error // 增加阅读数
 	IncrLikeCntIfPresent(ctx context.Context, biz string, id int64) error    // 用于增加点赞数
 	DecrLikeCntIfPresent(ctx context.Context, biz string, id int64) error    // 减少点赞数
 	IncrCollectCntIfPresent(ctx context.Context, biz string, id int64) error // 增加收藏数
+	DecrCollectCntIfPresent(ctx context.Context, biz string, id int64) error // 减少收藏数
+	// IncrReactionCntIfPresent 和 DecrReactionCntIfPresent 修改某种表态的数量,点赞用 LikeCnt 的方法
+	IncrReactionCntIfPresent(ctx context.Context, biz string, id int64, reaction string) error
+	DecrReactionCntIfPresent(ctx context.Context, biz string, id int64, reaction string) error
 	Get(ctx context.Context, biz string, id int64) (domain.Interactive, error)
 	Set(ctx context.Context, biz string, bizId int64, res domain.Interactive) error
+	// Del 删除缓存,下一次查询的时候从数据库重新加载
+	Del(ctx context.Context, biz string, bizId int64) error
 }
 
 type InteractiveRedisCache struct {
@@ -66,6 +74,29 @@ func (i *InteractiveRedisCache) IncrCollectCntIfPresent(ctx context.Context, biz
 	return i.client.Eval(ctx, luaIncrCnt, []string{key}, fieldCollectCnt, 1).Err() // 增加收藏数
 }
 
+// DecrCollectCntIfPresent 定义 DecrCollectCntIfPresent 方法,用于减少收藏数
+func (i *InteractiveRedisCache) DecrCollectCntIfPresent(ctx context.Context, biz string, id int64) error {
+	key := i.key(biz, id)
+
+	return i.client.Eval(ctx, luaIncrCnt, []string{key}, fieldCollectCnt, -1).Err() // 减少收藏数
+}
+
+// IncrReactionCntIfPresent 增加某种表态的数量
+func (i *InteractiveRedisCache) IncrReactionCntIfPresent(ctx context.Context,
+	biz string, id int64, reaction string) error {
+	key := i.key(biz, id)
+
+	return i.client.Eval(ctx, luaIncrCnt, []string{key}, fieldReactionPrefix+reaction, 1).Err()
+}
+
+// DecrReactionCntIfPresent 减少某种表态的数量
+func (i *InteractiveRedisCache) DecrReactionCntIfPresent(ctx context.Context,
+	biz string, id int64, reaction string) error {
+	key := i.key(biz, id)
+
+	return i.client.Eval(ctx, luaIncrCnt, []string{key}, fieldReactionPrefix+reaction, -1).Err()
+}
+
 func (i *InteractiveRedisCache) Get(ctx context.Context, biz string, id int64) (domain.Interactive, error) {
 	key := i.key(biz, id)
 
@@ -84,6 +115,16 @@ func (i *InteractiveRedisCache) Get(ctx context.Context, biz string, id int64) (
 	intr.CollectCnt, _ = strconv.ParseInt(res[fieldCollectCnt], 10, 64) // 将收藏数字段的值转换为整数,忽略错误
 	intr.LikeCnt, _ = strconv.ParseInt(res[fieldLikeCnt], 10, 64)       // 将点赞数字段的值转换为整数,忽略错误
 	intr.ReadCnt, _ = strconv.ParseInt(res[fieldReadCnt], 10, 64)       // 将阅读数字段的值转换为整数,忽略错误
+	for field, val := range res {
+		reaction, ok := strings.CutPrefix(field, fieldReactionPrefix)
+		if !ok {
+			continue
+		}
+		if intr.Reactions == nil {
+			intr.Reactions = make(map[string]int64)
+		}
+		intr.Reactions[reaction], _ = strconv.ParseInt(val, 10, 64)
+	}
 
 	return intr, nil // 返回 intr 对象和 nil 错误
 }
@@ -91,10 +132,18 @@ func (i *InteractiveRedisCache) Get(ctx context.Context, biz string, id int64) (
 func (i *InteractiveRedisCache) Set(ctx context.Context, biz string, bizId int64, res domain.Interactive) error {
 	key := i.key(biz, bizId)
 
-	err := i.client.HSet(ctx, key, fieldCollectCnt, res.CollectCnt,
+	vals := []any{fieldCollectCnt, res.CollectCnt,
 		fieldReadCnt, res.ReadCnt,
 		fieldLikeCnt, res.LikeCnt,
-	).Err() // 调用 Redis 的 HSet 方法设置交互数据的字段和值
+	}
+	for reaction, cnt := range res.Reactions {
+		// 点赞已经在 like_cnt 里面了
+		if reaction == domain.ReactionLike {
+			continue
+		}
+		vals = append(vals, fieldReactionPrefix+reaction, cnt)
+	}
+	err := i.client.HSet(ctx, key, vals...).Err() // 调用 Redis 的 HSet 方法设置交互数据的字段和值
 
 	if err != nil {
 		return err
@@ -103,6 +152,10 @@ func (i *InteractiveRedisCache) Set(ctx context.Context, biz string, bizId int64
 	return i.client.Expire(ctx, key, time.Minute*15).Err() // 调用 Redis 的 Expire 方法设置缓存的过期时间为 15 分钟
 }
 
+func (i *InteractiveRedisCache) Del(ctx context.Context, biz string, bizId int64) error {
+	return i.client.Del(ctx, i.key(biz, bizId)).Err()
+}
+
 func (i *InteractiveRedisCache) key(biz string, bizId int64) string {
 	return fmt.Sprintf("interactive:%s:%d", biz, bizId)
 }
@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"github.com/ClearloveHn/golangwebook/webook/internal/domain"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"strings"
+)
+
+var (
+	//go:embed lua/claim_delta.lua
+	luaClaimDelta string
+)
+
+const fieldRawReadCnt = "raw_read_cnt"
+
+// InteractiveDeltaCache 暂存还没有写回数据库的计数增量
+// 增量先累加到 pending 里面,写回的时候整个转移到 flushing 里面,
+// 写回成功一批删除一批,进程崩溃之后下一次写回会先处理 flushing 里面剩下的增量
+// 数据库已经提交但是删除失败的时候,这部分增量会被重复写回
+type InteractiveDeltaCache interface {
+	// Incr 累加增量,一次调用里面的增量要么都加上,要么都没加上
+	Incr(ctx context.Context, deltas []domain.InteractiveDelta) error
+	// Claim 返回要写回的增量,没有的时候返回空切片,解析不了的增量会被直接删除
+	Claim(ctx context.Context) ([]domain.InteractiveDelta, error)
+	// Ack 写回成功之后删除这些增量
+	Ack(ctx context.Context, deltas []domain.InteractiveDelta) error
+}
+
+type InteractiveDeltaRedisCache struct {
+	client      redis.Cmdable
+	pendingKey  string
+	flushingKey string
+}
+
+// NewInteractiveDeltaRedisCache 两个 key 带上同一个 hash tag,
+// Redis Cluster 里面会落在同一个 slot 上,claim_delta.lua 里面才能 RENAME
+func NewInteractiveDeltaRedisCache(client redis.Cmdable) InteractiveDeltaCache {
+	return &InteractiveDeltaRedisCache{
+		client:      client,
+		pendingKey:  "{interactive_delta}:pending",
+		flushingKey: "{interactive_delta}:flushing",
+	}
+}
+
+// Incr 用 MULTI 包起来,同一批增量不会只加上一部分
+func (i *InteractiveDeltaRedisCache) Incr(ctx context.Context, deltas []domain.InteractiveDelta) error {
+	_, err := i.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, d := range deltas {
+			for _, fv := range i.fieldValues(d) {
+				if fv.val != 0 {
+					pipe.HIncrBy(ctx, i.pendingKey, fv.field, fv.val)
+				}
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+func (i *InteractiveDeltaRedisCache) Claim(ctx context.Context) ([]domain.InteractiveDelta, error) {
+	vals, err := i.client.Eval(ctx, luaClaimDelta,
+		[]string{i.pendingKey, i.flushingKey}).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+
+	type bizKey struct {
+		biz   string
+		bizId int64
+	}
+	idx := make(map[bizKey]int)
+	res := make([]domain.InteractiveDelta, 0, len(vals)/6)
+	// 解析不了的留在 flushing 里面的话,flushing 永远删不完,之后的增量也就一直写不回去
+	var bad []string
+	for j := 0; j+1 < len(vals); j += 2 {
+		biz, bizId, cnt, ok := i.parseField(vals[j])
+		if !ok {
+			bad = append(bad, vals[j])
+			continue
+		}
+		val, err := strconv.ParseInt(vals[j+1], 10, 64)
+		// 以前版本留下来的点赞数增量也当作解析不了,点赞数写回的时候会重新计算
+		if err != nil || (cnt != fieldReadCnt && cnt != fieldRawReadCnt && cnt != fieldCollectCnt) {
+			bad = append(bad, vals[j])
+			continue
+		}
+		k := bizKey{biz: biz, bizId: bizId}
+		pos, ok := idx[k]
+		if !ok {
+			pos = len(res)
+			idx[k] = pos
+			res = append(res, domain.InteractiveDelta{Biz: biz, BizId: bizId})
+		}
+		d := &res[pos]
+		switch cnt {
+		case fieldReadCnt:
+			d.ReadCnt = val
+		case fieldRawReadCnt:
+			d.RawReadCnt = val
+		case fieldCollectCnt:
+			d.CollectCnt = val
+		}
+	}
+	if len(bad) > 0 {
+		err = i.client.HDel(ctx, i.flushingKey, bad...).Err()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (i *InteractiveDeltaRedisCache) Ack(ctx context.Context, deltas []domain.InteractiveDelta) error {
+	if len(deltas) == 0 {
+		return nil
+	}
+	fields := make([]string, 0, len(deltas)*3)
+	for _, d := range deltas {
+		for _, fv := range i.fieldValues(d) {
+			fields = append(fields, fv.field)
+		}
+	}
+	return i.client.HDel(ctx, i.flushingKey, fields...).Err()
+}
+
+type deltaField struct {
+	field string
+	val   int64
+}
+
+func (i *InteractiveDeltaRedisCache) fieldValues(d domain.InteractiveDelta) []deltaField {
+	return []deltaField{
+		{field: i.field(d.Biz, d.BizId, fieldReadCnt), val: d.ReadCnt},
+		{field: i.field(d.Biz, d.BizId, fieldRawReadCnt), val: d.RawReadCnt},
+		{field: i.field(d.Biz, d.BizId, fieldCollectCnt), val: d.CollectCnt},
+	}
+}
+
+// field 的格式是 biz:bizId:cnt,biz 里面可能有冒号,所以解析的时候从后往前找
+func (i *InteractiveDeltaRedisCache) field(biz string, bizId int64, cnt string) string {
+	return fmt.Sprintf("%s:%d:%s", biz, bizId, cnt)
+}
+
+func (i *InteractiveDeltaRedisCache) parseField(field string) (string, int64, string, bool) {
+	pos := strings.LastIndexByte(field, ':')
+	if pos <= 0 {
+		return "", 0, "", false
+	}
+	cnt := field[pos+1:]
+	rest := field[:pos]
+	pos = strings.LastIndexByte(rest, ':')
+	if pos <= 0 {
+		return "", 0, "", false
+	}
+	bizId, err := strconv.ParseInt(rest[pos+1:], 10, 64)
+	if err != nil {
+		return "", 0, "", false
+	}
+	return rest[:pos], bizId, cnt, true
+}
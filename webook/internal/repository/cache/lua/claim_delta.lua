@@ -0,0 +1,14 @@
+-- 待写回的增量
+local pending = KEYS[1]
+-- 写回中的增量
+local flushing = KEYS[2]
+
+-- 上一次写回没有完成,比如说进程崩溃了,先把剩下的写回
+if redis.call("EXISTS", flushing) == 0 then
+    if redis.call("EXISTS", pending) == 0 then
+        return {}
+    end
+    -- 之后的增量会累加到新的 pending 里面
+    redis.call("RENAME", pending, flushing)
+end
+return redis.call("HGETALL", flushing)
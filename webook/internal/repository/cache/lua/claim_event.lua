@@ -0,0 +1,14 @@
+-- 占住一个事件
+-- 返回 1 表示占到了,0 表示已经处理过,-1 表示别的消费者正在处理
+local key = KEYS[1]
+local processing = ARGV[1]
+local done = ARGV[2]
+local ttl = tonumber(ARGV[3])
+
+if redis.call("SET", key, processing, "NX", "PX", ttl) then
+    return 1
+end
+if redis.call("GET", key) == done then
+    return 0
+end
+return -1
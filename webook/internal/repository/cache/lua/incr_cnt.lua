@@ -2,7 +2,7 @@
 -- 获取传入的键名
 local key = KEYS[1]
 
--- 获取要增加的计数类型(阅读数、点赞数或收藏数)
+-- 获取要增加的计数类型(阅读数、点赞数、收藏数或者 reaction: 开头的表态数)
 local cntKey = ARGV[1]
 -- 获取增加的计数值
 local delta = tonumber(ARGV[2])
@@ -13,7 +13,11 @@ local exist = redis.call("EXISTS", key)
 -- 如果键存在
 if exist == 1 then
     -- 使用 HINCRBY 命令对指定字段的值进行增量操作
-    redis.call("HINCRBY", key, cntKey, delta)
+    local val = redis.call("HINCRBY", key, cntKey, delta)
+    -- 缓存里面的计数不能减到负数
+    if val < 0 then
+        redis.call("HSET", key, cntKey, 0)
+    end
     -- 返回 1 表示操作成功
     return 1
 else
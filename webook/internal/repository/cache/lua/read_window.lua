@@ -0,0 +1,21 @@
+-- 去重窗口内的第一次阅读
+-- KEYS 是每一次阅读的 key,ARGV[1] 是窗口的毫秒数,ARGV[i+1] 是第 i 次阅读的事件 ID
+local window = tonumber(ARGV[1])
+local res = {}
+
+for i, key in ipairs(KEYS) do
+    local id = ARGV[i + 1]
+    local val = redis.call("GET", key)
+    if val == false then
+        -- 窗口内的第一次阅读,记录下事件 ID
+        redis.call("SET", key, id, "PX", window)
+        res[i] = 1
+    elseif val == id then
+        -- 同一个事件重试,依旧算第一次
+        res[i] = 1
+    else
+        res[i] = 0
+    end
+end
+
+return res
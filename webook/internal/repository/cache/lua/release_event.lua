@@ -0,0 +1,7 @@
+-- 只删除还在处理中的事件,已经处理成功的保留下来
+local key = KEYS[1]
+local processing = ARGV[1]
+if redis.call("GET", key) == processing then
+    return redis.call("DEL", key)
+end
+return 0
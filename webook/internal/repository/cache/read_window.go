@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+//go:embed lua/read_window.lua
+var luaReadWindow string
+
+// ReadWindow 一次阅读,Reader 是读者的标识,登录用户用 uid,匿名用户用 IP 和 User-Agent
+type ReadWindow struct {
+	EventId int64
+	Biz     string
+	BizId   int64
+	Reader  string
+}
+
+// ReadWindowCache 记录读者在去重窗口内是否读过
+type ReadWindowCache interface {
+	// FirstRead 返回和 reads 一一对应的结果,true 表示窗口内的第一次阅读
+	// 同一个事件重复调用的结果是一样的,所以消费失败重试的时候不会被当成重复阅读
+	FirstRead(ctx context.Context, reads []ReadWindow, window time.Duration) ([]bool, error)
+}
+
+type RedisReadWindowCache struct {
+	client redis.Cmdable
+}
+
+func NewRedisReadWindowCache(client redis.Cmdable) ReadWindowCache {
+	return &RedisReadWindowCache{client: client}
+}
+
+func (c *RedisReadWindowCache) FirstRead(ctx context.Context,
+	reads []ReadWindow, window time.Duration) ([]bool, error) {
+	if len(reads) == 0 {
+		return nil, nil
+	}
+	keys := make([]string, 0, len(reads))
+	args := make([]any, 0, len(reads)+1)
+	args = append(args, window.Milliseconds())
+	for _, r := range reads {
+		keys = append(keys, c.key(r))
+		args = append(args, strconv.FormatInt(r.EventId, 10))
+	}
+	vals, err := c.client.Eval(ctx, luaReadWindow, keys, args...).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]bool, len(reads))
+	for i := range res {
+		res[i] = i < len(vals) && vals[i] == 1
+	}
+	return res, nil
+}
+
+func (c *RedisReadWindowCache) key(r ReadWindow) string {
+	return fmt.Sprintf("read_window:%s:%d:%s", r.Biz, r.BizId, r.Reader)
+}
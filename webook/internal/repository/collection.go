@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"github.com/ClearloveHn/golangwebook/webook/internal/domain"
+	"github.com/ClearloveHn/golangwebook/webook/internal/repository/cache"
+	"github.com/ClearloveHn/golangwebook/webook/internal/repository/dao"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
+	"github.com/ecodeclub/ekit/slice"
+	"time"
+)
+
+var (
+	// ErrCollectionNotFound 收藏夹不存在,或者不是自己的
+	ErrCollectionNotFound = dao.ErrCollectionNotFound
+	// ErrCollectionItemNotFound 没有收藏过
+	ErrCollectionItemNotFound = dao.ErrRecordNotFound
+)
+
+type CollectionRepository interface {
+	Create(ctx context.Context, c domain.Collection) (int64, error)
+	Update(ctx context.Context, c domain.Collection) error
+	// Delete 删除收藏夹,里面的收藏也一起删除,收藏数同步减少
+	Delete(ctx context.Context, uid int64, id int64) error
+	FindById(ctx context.Context, id int64) (domain.Collection, error)
+	FindByUid(ctx context.Context, uid int64, publicOnly bool, offset int, limit int) ([]domain.Collection, error)
+	ListItems(ctx context.Context, uid int64, cid int64, offset int, limit int) ([]domain.CollectionItem, error)
+	MoveItem(ctx context.Context, uid int64, biz string, bizId int64, cid int64) error
+}
+
+type GORMCollectionRepository struct {
+	dao dao.CollectionDAO
+	// intrCache 删除收藏夹的时候要减少缓存里面的收藏数
+	intrCache cache.InteractiveCache
+	l         logger.LoggerV1
+}
+
+func NewGORMCollectionRepository(dao dao.CollectionDAO,
+	intrCache cache.InteractiveCache, l logger.LoggerV1) CollectionRepository {
+	return &GORMCollectionRepository{dao: dao, intrCache: intrCache, l: l}
+}
+
+func (r *GORMCollectionRepository) Create(ctx context.Context, c domain.Collection) (int64, error) {
+	return r.dao.Insert(ctx, r.toEntity(c))
+}
+
+func (r *GORMCollectionRepository) Update(ctx context.Context, c domain.Collection) error {
+	return r.dao.UpdateInfo(ctx, r.toEntity(c))
+}
+
+func (r *GORMCollectionRepository) Delete(ctx context.Context, uid int64, id int64) error {
+	items, err := r.dao.Delete(ctx, uid, id)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		er := r.intrCache.DecrCollectCntIfPresent(ctx, item.Biz, item.BizId)
+		if er != nil {
+			// 缓存很快就会过期,不影响删除
+			r.l.Error("删除收藏夹之后更新收藏数缓存失败",
+				logger.String("biz", item.Biz),
+				logger.Int64("bizId", item.BizId),
+				logger.Error(er))
+		}
+	}
+	return nil
+}
+
+func (r *GORMCollectionRepository) FindById(ctx context.Context, id int64) (domain.Collection, error) {
+	c, err := r.dao.FindById(ctx, id)
+	if err != nil {
+		return domain.Collection{}, err
+	}
+	return r.toDomain(c), nil
+}
+
+func (r *GORMCollectionRepository) FindByUid(ctx context.Context, uid int64,
+	publicOnly bool, offset int, limit int) ([]domain.Collection, error) {
+	cs, err := r.dao.FindByUid(ctx, uid, publicOnly, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map[dao.Collection, domain.Collection](cs,
+		func(idx int, src dao.Collection) domain.Collection {
+			return r.toDomain(src)
+		}), nil
+}
+
+func (r *GORMCollectionRepository) ListItems(ctx context.Context, uid int64,
+	cid int64, offset int, limit int) ([]domain.CollectionItem, error) {
+	items, err := r.dao.ListItems(ctx, uid, cid, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map[dao.UserCollectionBiz, domain.CollectionItem](items,
+		func(idx int, src dao.UserCollectionBiz) domain.CollectionItem {
+			return domain.CollectionItem{
+				Id:    src.Id,
+				Cid:   src.Cid,
+				Uid:   src.Uid,
+				Biz:   src.Biz,
+				BizId: src.BizId,
+				Ctime: time.UnixMilli(src.Ctime),
+			}
+		}), nil
+}
+
+func (r *GORMCollectionRepository) MoveItem(ctx context.Context, uid int64,
+	biz string, bizId int64, cid int64) error {
+	return r.dao.MoveItem(ctx, uid, biz, bizId, cid)
+}
+
+func (r *GORMCollectionRepository) toEntity(c domain.Collection) dao.Collection {
+	return dao.Collection{
+		Id:          c.Id,
+		Uid:         c.Uid,
+		Name:        c.Name,
+		Description: c.Description,
+		Visibility:  c.Visibility.ToUint8(),
+	}
+}
+
+func (r *GORMCollectionRepository) toDomain(c dao.Collection) domain.Collection {
+	return domain.Collection{
+		Id:          c.Id,
+		Uid:         c.Uid,
+		Name:        c.Name,
+		Description: c.Description,
+		Visibility:  domain.CollectionVisibility(c.Visibility),
+		ItemCnt:     c.ItemCnt,
+		Ctime:       time.UnixMilli(c.Ctime),
+		Utime:       time.UnixMilli(c.Utime),
+	}
+}
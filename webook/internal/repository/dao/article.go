@@ -19,6 +19,7 @@ type ArticleDAO interface {
 	GetByAuthor(ctx context.Context, uid int64, offset int, limit int) ([]Article, error)            // 根据作者 ID 获取文章列表
 	GetById(ctx context.Context, id int64) (Article, error)                                          // 根据 ID 获取文章
 	GetPubById(ctx context.Context, id int64) (PublishedArticle, error)                              // 根据 ID 获取已发布的文章
+	GetPubByIds(ctx context.Context, ids []int64) ([]PublishedArticle, error)                        // 根据 ID 批量获取已发布的文章
 	ListPub(ctx context.Context, start time.Time, offset int, limit int) ([]PublishedArticle, error) // 获取已发布的文章列表
 }
 
@@ -139,7 +140,7 @@ func (a *ArticleGORMDAO) SyncStatus(ctx context.Context, uid int64, id int64, st
 	// 使用 GORM 的 Transaction 方法开启事务
 	return a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		res := tx.Model(&Article{}). // 使用 GORM 的 Model 方法更新文章状态
-						Where("id = ? and author_id = ?", uid, id). // 指定更新条件
+						Where("id = ? and author_id = ?", id, uid). // 指定更新条件
 						Updates(map[string]any{                     // 指定更新内容
 				"utime":  now,    // 更新文章的更新时间
 				"status": status, // 更新文章状态
@@ -153,7 +154,7 @@ func (a *ArticleGORMDAO) SyncStatus(ctx context.Context, uid int64, id int64, st
 
 		// 使用 GORM 的 Model 方法更新已发布文章的状态
 		return tx.Model(&PublishedArticle{}).
-			Where("id = ?", uid).   // 指定更新条件
+			Where("id = ?", id).    // 指定更新条件
 			Updates(map[string]any{ // 指定更新内容
 				"utime":  now,    // 更新已发布文章的更新时间
 				"status": status, // 更新已发布文章的状态
@@ -195,6 +196,15 @@ func (a *ArticleGORMDAO) GetPubById(ctx context.Context, id int64) (PublishedArt
 	return res, err
 }
 
+// GetPubByIds 方法,根据 ID 批量获取已发布的文章,不存在的文章不会出现在结果里面
+func (a *ArticleGORMDAO) GetPubByIds(ctx context.Context, ids []int64) ([]PublishedArticle, error) {
+	var res []PublishedArticle
+	err := a.db.WithContext(ctx).
+		Where("id IN ?", ids).
+		Find(&res).Error
+	return res, err
+}
+
 // ListPub 方法,获取已发布的文章列表
 func (a *ArticleGORMDAO) ListPub(ctx context.Context, start time.Time, offset int, limit int) ([]PublishedArticle, error) {
 	var res []PublishedArticle       // 定义已发布文章切片
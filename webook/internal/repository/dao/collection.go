@@ -0,0 +1,244 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"sort"
+	"time"
+)
+
+// ErrCollectionNotFound 收藏夹不存在或者不是自己的
+// 不能直接用 ErrRecordNotFound,不然和收藏记录不存在分不开
+var ErrCollectionNotFound = errors.New("收藏夹不存在")
+
+// CollectionDAO 收藏夹的数据访问操作
+// 收藏夹的收藏数量和 Interactive 的收藏数都是和收藏记录在同一个事务里面维护的
+type CollectionDAO interface {
+	Insert(ctx context.Context, c Collection) (int64, error)
+	// UpdateInfo 修改名字、描述和可见性,只能修改自己的收藏夹,收藏夹不存在返回 ErrCollectionNotFound
+	UpdateInfo(ctx context.Context, c Collection) error
+	// Delete 删除收藏夹和里面的收藏,返回被删除的收藏,用于更新缓存,收藏夹不存在返回 ErrCollectionNotFound
+	Delete(ctx context.Context, uid int64, id int64) ([]UserCollectionBiz, error)
+	// FindById 收藏夹不存在返回 ErrCollectionNotFound
+	FindById(ctx context.Context, id int64) (Collection, error)
+	// FindByUid publicOnly 为 true 的时候只查询公开的收藏夹
+	FindByUid(ctx context.Context, uid int64, publicOnly bool, offset int, limit int) ([]Collection, error)
+	// ListItems 查询收藏夹里面的收藏,cid 为 0 的是没有放到任何收藏夹里面的
+	ListItems(ctx context.Context, uid int64, cid int64, offset int, limit int) ([]UserCollectionBiz, error)
+	// MoveItem 把一条收藏移动到另外一个收藏夹,收藏数不变
+	// 没有收藏过返回 ErrRecordNotFound,目标收藏夹不存在返回 ErrCollectionNotFound
+	MoveItem(ctx context.Context, uid int64, biz string, bizId int64, cid int64) error
+}
+
+type GORMCollectionDAO struct {
+	db *gorm.DB
+}
+
+func NewGORMCollectionDAO(db *gorm.DB) CollectionDAO {
+	return &GORMCollectionDAO{db: db}
+}
+
+func (dao *GORMCollectionDAO) Insert(ctx context.Context, c Collection) (int64, error) {
+	now := time.Now().UnixMilli()
+	c.Ctime = now
+	c.Utime = now
+	err := dao.db.WithContext(ctx).Create(&c).Error
+	return c.Id, err
+}
+
+func (dao *GORMCollectionDAO) UpdateInfo(ctx context.Context, c Collection) error {
+	res := dao.db.WithContext(ctx).Model(&Collection{}).
+		Where("id = ? AND uid = ?", c.Id, c.Uid).
+		Updates(map[string]any{
+			"name":        c.Name,
+			"description": c.Description,
+			"visibility":  c.Visibility,
+			"utime":       time.Now().UnixMilli(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		// 要么收藏夹不存在,要么不是自己的
+		return ErrCollectionNotFound
+	}
+	return nil
+}
+
+func (dao *GORMCollectionDAO) Delete(ctx context.Context, uid int64, id int64) ([]UserCollectionBiz, error) {
+	var items []UserCollectionBiz
+	now := time.Now().UnixMilli()
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var c Collection
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND uid = ?", id, uid).
+			First(&c).Error
+		if errors.Is(err, ErrRecordNotFound) {
+			return ErrCollectionNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		err = tx.Where("uid = ? AND cid = ?", uid, id).Find(&items).Error
+		if err != nil {
+			return err
+		}
+		if len(items) > 0 {
+			err = dao.decrCollectCnt(tx, items, now)
+			if err != nil {
+				return err
+			}
+			ids := make([]int64, 0, len(items))
+			for _, item := range items {
+				ids = append(ids, item.Id)
+			}
+			err = tx.Where("id IN ?", ids).Delete(&UserCollectionBiz{}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&c).Error
+	})
+	return items, err
+}
+
+// decrCollectCnt 按照 biz 分组,每组按照 biz_id 排序之后分批减少收藏数
+// 一批一条 UPDATE,减少持有收藏夹行锁的时间;
+// 加锁的顺序固定,并发删除两个收藏夹的时候不会互相死锁
+func (dao *GORMCollectionDAO) decrCollectCnt(tx *gorm.DB, items []UserCollectionBiz, now int64) error {
+	const batchSize = 100
+	groups := make(map[string][]int64)
+	for _, item := range items {
+		// 同一个用户对同一个资源只有一条收藏,所以每个资源减一
+		groups[item.Biz] = append(groups[item.Biz], item.BizId)
+	}
+	bizs := make([]string, 0, len(groups))
+	for biz := range groups {
+		bizs = append(bizs, biz)
+	}
+	sort.Strings(bizs)
+
+	for _, biz := range bizs {
+		bizIds := groups[biz]
+		sort.Slice(bizIds, func(i, j int) bool {
+			return bizIds[i] < bizIds[j]
+		})
+		for start := 0; start < len(bizIds); start += batchSize {
+			end := min(start+batchSize, len(bizIds))
+			err := tx.Model(&Interactive{}).
+				Where("biz = ? AND biz_id IN ? AND collect_cnt > 0", biz, bizIds[start:end]).
+				Updates(map[string]any{
+					"collect_cnt": gorm.Expr("`collect_cnt` - 1"),
+					"utime":       now,
+				}).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (dao *GORMCollectionDAO) FindById(ctx context.Context, id int64) (Collection, error) {
+	var res Collection
+	err := dao.db.WithContext(ctx).Where("id = ?", id).First(&res).Error
+	if errors.Is(err, ErrRecordNotFound) {
+		return res, ErrCollectionNotFound
+	}
+	return res, err
+}
+
+func (dao *GORMCollectionDAO) FindByUid(ctx context.Context, uid int64,
+	publicOnly bool, offset int, limit int) ([]Collection, error) {
+	var res []Collection
+	db := dao.db.WithContext(ctx).Where("uid = ?", uid)
+	if publicOnly {
+		db = db.Where("visibility = ?", CollectionVisibilityPublic)
+	}
+	err := db.Order("id DESC").Offset(offset).Limit(limit).Find(&res).Error
+	return res, err
+}
+
+func (dao *GORMCollectionDAO) ListItems(ctx context.Context, uid int64,
+	cid int64, offset int, limit int) ([]UserCollectionBiz, error) {
+	var res []UserCollectionBiz
+	err := dao.db.WithContext(ctx).
+		Where("cid = ? AND uid = ?", cid, uid).
+		Order("id DESC").Offset(offset).Limit(limit).
+		Find(&res).Error
+	return res, err
+}
+
+func (dao *GORMCollectionDAO) MoveItem(ctx context.Context, uid int64,
+	biz string, bizId int64, cid int64) error {
+	now := time.Now().UnixMilli()
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var item UserCollectionBiz
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("uid = ? AND biz = ? AND biz_id = ?", uid, biz, bizId).
+			First(&item).Error
+		if err != nil {
+			return err
+		}
+		if item.Cid == cid {
+			return nil
+		}
+
+		// 先加目标收藏夹,顺便校验收藏夹是不是自己的
+		err = incrCollectionItemCnt(tx, uid, cid, 1, now)
+		if err != nil {
+			return err
+		}
+		err = incrCollectionItemCnt(tx, uid, item.Cid, -1, now)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&UserCollectionBiz{}).
+			Where("id = ?", item.Id).
+			Updates(map[string]any{
+				"cid":   cid,
+				"utime": now,
+			}).Error
+	})
+}
+
+// incrCollectionItemCnt 调整收藏夹的收藏数量,收藏夹不存在或者不是 uid 的返回 ErrCollectionNotFound
+// cid 为 0 的不是真正的收藏夹,什么也不做
+func incrCollectionItemCnt(tx *gorm.DB, uid int64, cid int64, delta int64, now int64) error {
+	if cid == 0 {
+		return nil
+	}
+	res := tx.Model(&Collection{}).
+		Where("id = ? AND uid = ?", cid, uid).
+		Updates(map[string]any{
+			"item_cnt": gorm.Expr("`item_cnt` + ?", delta),
+			"utime":    now,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrCollectionNotFound
+	}
+	return nil
+}
+
+const (
+	CollectionVisibilityPrivate uint8 = iota + 1
+	CollectionVisibilityPublic
+)
+
+// Collection 收藏夹
+type Collection struct {
+	Id          int64  `gorm:"primaryKey,autoIncrement"`
+	Uid         int64  `gorm:"index"`
+	Name        string `gorm:"type:varchar(256)"`
+	Description string `gorm:"type:varchar(1024)"`
+	Visibility  uint8
+	ItemCnt     int64 // 收藏数量
+	Utime       int64
+	Ctime       int64
+}
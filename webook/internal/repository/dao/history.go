@@ -0,0 +1,222 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// HistoryRecordDAO 浏览记录的数据访问操作
+type HistoryRecordDAO interface {
+	// Upsert 没有浏览过就插入,浏览过就更新浏览时间
+	Upsert(ctx context.Context, r HistoryRecord) error
+	// List 按照浏览时间倒序查询,utime 和 id 为 0 的时候从最新的开始
+	List(ctx context.Context, uid int64, utime int64, id int64, limit int) ([]HistoryRecord, error)
+	Delete(ctx context.Context, uid int64, id int64) error
+	DeleteByUid(ctx context.Context, uid int64) error
+	// UpdateProgress 更新阅读进度,duration 累加到原来的阅读时长上,同时更新文章的进度统计
+	UpdateProgress(ctx context.Context, r HistoryRecord, duration int64) error
+	// ListUnfinished 按照浏览时间倒序查询开始读了但是没有读完的
+	ListUnfinished(ctx context.Context, uid int64, finished int, limit int) ([]HistoryRecord, error)
+	GetProgressStats(ctx context.Context, biz string, bizIds []int64) ([]ReadProgressStat, error)
+}
+
+type GORMHistoryRecordDAO struct {
+	db *gorm.DB
+}
+
+func NewGORMHistoryRecordDAO(db *gorm.DB) HistoryRecordDAO {
+	return &GORMHistoryRecordDAO{db: db}
+}
+
+// Upsert 插入或者更新浏览时间
+func (dao *GORMHistoryRecordDAO) Upsert(ctx context.Context, r HistoryRecord) error {
+	now := time.Now().UnixMilli()
+	r.Ctime = now
+	r.Utime = now
+	return dao.db.WithContext(ctx).Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"utime": now,
+		}),
+	}).Create(&r).Error
+}
+
+// List 使用 (utime, id) 作为游标,避免 offset 翻页越往后越慢
+func (dao *GORMHistoryRecordDAO) List(ctx context.Context, uid int64,
+	utime int64, id int64, limit int) ([]HistoryRecord, error) {
+	var res []HistoryRecord
+	db := dao.db.WithContext(ctx).Where("uid = ?", uid)
+	if utime > 0 || id > 0 {
+		// 浏览时间一样的时候用 id 区分,保证不会漏掉也不会重复
+		db = db.Where("utime < ? OR (utime = ? AND id < ?)", utime, utime, id)
+	}
+	err := db.Order("utime DESC, id DESC").Limit(limit).Find(&res).Error
+	return res, err
+}
+
+// Delete 删除一条浏览记录,只能删除自己的
+func (dao *GORMHistoryRecordDAO) Delete(ctx context.Context, uid int64, id int64) error {
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return dao.deleteRecords(tx, "id = ? AND uid = ?", id, uid)
+	})
+}
+
+// DeleteByUid 清空用户的浏览记录
+func (dao *GORMHistoryRecordDAO) DeleteByUid(ctx context.Context, uid int64) error {
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return dao.deleteRecords(tx, "uid = ?", uid)
+	})
+}
+
+// deleteRecords 删除记录的同时把这些读者从进度统计里面减掉
+// 不然读者删掉记录之后再来读,UpdateProgress 会把他当成新的读者再算一次
+func (dao *GORMHistoryRecordDAO) deleteRecords(tx *gorm.DB, query string, args ...interface{}) error {
+	var records []HistoryRecord
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where(query, args...).Find(&records).Error
+	if err != nil || len(records) == 0 {
+		return err
+	}
+	ids := make([]int64, 0, len(records))
+	for _, r := range records {
+		ids = append(ids, r.Id)
+	}
+	err = tx.Where("id IN ?", ids).Delete(&HistoryRecord{}).Error
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UnixMilli()
+	for _, r := range records {
+		// 没有上报过进度的读者没有计入统计
+		if r.MaxProgress == 0 {
+			continue
+		}
+		err = tx.Model(&ReadProgressStat{}).
+			Where("biz = ? AND biz_id = ? AND reader_cnt > 0", r.Biz, r.BizId).
+			Updates(map[string]interface{}{
+				"reader_cnt":   gorm.Expr("`reader_cnt` - 1"),
+				"progress_sum": gorm.Expr("`progress_sum` - ?", r.MaxProgress),
+				"utime":        now,
+			}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateProgress 在事务里面读出原来的最大进度,算出统计需要调整的差值
+// 统计只看最大进度,读者往回翻不会拉低完成率
+func (dao *GORMHistoryRecordDAO) UpdateProgress(ctx context.Context, r HistoryRecord, duration int64) error {
+	now := time.Now().UnixMilli()
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var old HistoryRecord
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("uid = ? AND biz = ? AND biz_id = ?", r.Uid, r.Biz, r.BizId).
+			First(&old).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		maxProgress := max(old.MaxProgress, r.Progress)
+		// 没有记录的时候插入,和消费者并发插入冲突的时候走更新
+		err = tx.Clauses(clause.OnConflict{
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"position":     r.Position,
+				"progress":     r.Progress,
+				"max_progress": maxProgress,
+				"duration":     gorm.Expr("`duration` + ?", duration),
+				"utime":        now,
+			}),
+		}).Create(&HistoryRecord{
+			Uid:         r.Uid,
+			Biz:         r.Biz,
+			BizId:       r.BizId,
+			Position:    r.Position,
+			Progress:    r.Progress,
+			MaxProgress: maxProgress,
+			Duration:    duration,
+			Ctime:       now,
+			Utime:       now,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		delta := maxProgress - old.MaxProgress
+		if delta == 0 {
+			return nil
+		}
+		var readerDelta int64
+		if old.MaxProgress == 0 {
+			// 第一次上报进度的读者
+			readerDelta = 1
+		}
+		return tx.Clauses(clause.OnConflict{
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"reader_cnt":   gorm.Expr("`reader_cnt` + ?", readerDelta),
+				"progress_sum": gorm.Expr("`progress_sum` + ?", delta),
+				"utime":        now,
+			}),
+		}).Create(&ReadProgressStat{
+			Biz:         r.Biz,
+			BizId:       r.BizId,
+			ReaderCnt:   readerDelta,
+			ProgressSum: int64(delta),
+			Ctime:       now,
+			Utime:       now,
+		}).Error
+	})
+}
+
+// ListUnfinished 进度为 0 的是只打开过,没有上报过进度的,不算
+func (dao *GORMHistoryRecordDAO) ListUnfinished(ctx context.Context, uid int64,
+	finished int, limit int) ([]HistoryRecord, error) {
+	var res []HistoryRecord
+	err := dao.db.WithContext(ctx).
+		Where("uid = ? AND max_progress > 0 AND max_progress < ?", uid, finished).
+		Order("utime DESC").Limit(limit).Find(&res).Error
+	return res, err
+}
+
+// GetProgressStats 批量查询进度统计,没有统计的不会出现在结果里面
+func (dao *GORMHistoryRecordDAO) GetProgressStats(ctx context.Context,
+	biz string, bizIds []int64) ([]ReadProgressStat, error) {
+	var res []ReadProgressStat
+	err := dao.db.WithContext(ctx).
+		Where("biz = ? AND biz_id IN ?", biz, bizIds).
+		Find(&res).Error
+	return res, err
+}
+
+// HistoryRecord 浏览记录
+// uid_utime 用于按照浏览时间翻页,uid_biz_type_id 保证同一个业务只有一条记录
+type HistoryRecord struct {
+	Id    int64  `gorm:"primaryKey,autoIncrement"`
+	Uid   int64  `gorm:"uniqueIndex:uid_biz_type_id;index:uid_utime,priority:1"`
+	BizId int64  `gorm:"uniqueIndex:uid_biz_type_id"`
+	Biz   string `gorm:"type:varchar(128);uniqueIndex:uid_biz_type_id"`
+
+	Position    int64 // 滚动位置
+	Progress    int   // 最近一次上报的进度,0 到 100
+	MaxProgress int   // 读到过的最大进度
+	Duration    int64 // 累计阅读时长,毫秒
+
+	Utime int64 `gorm:"index:uid_utime,priority:2"`
+	Ctime int64
+}
+
+// ReadProgressStat 每篇文章的阅读进度统计
+// 平均完成率就是 ProgressSum / ReaderCnt,每个读者按照最大进度计算
+type ReadProgressStat struct {
+	Id          int64  `gorm:"primaryKey,autoIncrement"`
+	BizId       int64  `gorm:"uniqueIndex:biz_type_id"`
+	Biz         string `gorm:"type:varchar(128);uniqueIndex:biz_type_id"`
+	ReaderCnt   int64  // 上报过进度的读者数量
+	ProgressSum int64  // 所有读者最大进度的和
+	Utime       int64
+	Ctime       int64
+}
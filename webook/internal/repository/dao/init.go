@@ -18,8 +18,14 @@ func InitTables(db *gorm.DB) error {
 		&PublishedArticle{},
 		&Interactive{},
 		&UserLikeBiz{},
+		&UserReactionBiz{},
+		&ReactionCnt{},
 		&UserCollectionBiz{},
+		&Collection{},
 		&Job{},
+		&OutboxEvent{},
+		&HistoryRecord{},
+		&ReadProgressStat{},
 	)
 }
 
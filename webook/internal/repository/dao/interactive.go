@@ -2,6 +2,8 @@ package dao
 
 import (
 	"context"
+	"errors"
+	"github.com/go-sql-driver/mysql"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 	"time"
@@ -10,9 +12,30 @@ import (
 type InteractiveDAO interface {
 	IncrReadCnt(ctx context.Context, biz string, bizId int64) error
 	BatchIncrReadCnt(ctx context.Context, bizs []string, bizIds []int64) error
-	InsertLikeInfo(ctx context.Context, biz string, id int64, uid int64) error
-	DeleteLikeInfo(ctx context.Context, biz string, id int64, uid int64) error
-	InsertCollectionBiz(ctx context.Context, cb UserCollectionBiz) error
+	// BatchIncrRawReadCnt 只增加原始阅读计数,用于去重窗口内的重复阅读
+	BatchIncrRawReadCnt(ctx context.Context, bizs []string, bizIds []int64) error
+	// BatchIncrCnts 批量写回计数的增量,增量可以是负数
+	BatchIncrCnts(ctx context.Context, deltas []InteractiveDelta) error
+	// ListLikeChanged 查询 since 之后点赞状态变过的资源,返回的 UserLikeBiz 只有 Biz 和 BizId
+	ListLikeChanged(ctx context.Context, since int64) ([]UserLikeBiz, error)
+	// SyncLikeCnts 按照点赞记录重新计算点赞数,biz 和 bizId 长度必须一致
+	SyncLikeCnts(ctx context.Context, biz []string, bizId []int64) error
+	// InsertLikeInfo 和 DeleteLikeInfo 返回的 bool 表示点赞状态是否真的变了
+	InsertLikeInfo(ctx context.Context, biz string, id int64, uid int64) (bool, error)
+	DeleteLikeInfo(ctx context.Context, biz string, id int64, uid int64) (bool, error)
+	// InsertCollectionBiz 重复收藏的时候什么也不做,返回的 bool 表示是否真的收藏了
+	InsertCollectionBiz(ctx context.Context, cb UserCollectionBiz) (bool, error)
+	// DeleteCollectionBiz 没有收藏的时候什么也不做,返回的 bool 表示是否真的取消了
+	DeleteCollectionBiz(ctx context.Context, biz string, id int64, uid int64) (bool, error)
+	// InsertReaction 和 DeleteReaction 返回的 bool 表示表态的状态是否真的变了,点赞不走这两个方法
+	InsertReaction(ctx context.Context, biz string, id int64, uid int64, reaction string) (bool, error)
+	DeleteReaction(ctx context.Context, biz string, id int64, uid int64, reaction string) (bool, error)
+	GetReactionCnts(ctx context.Context, biz string, id int64) ([]ReactionCnt, error)
+	// GetReactionCntsByIds 批量获取每种表态的数量,没有表态的不会出现在结果里面
+	GetReactionCntsByIds(ctx context.Context, biz string, ids []int64) ([]ReactionCnt, error)
+	GetUserReactions(ctx context.Context, biz string, id int64, uid int64) ([]UserReactionBiz, error)
+	// SetLikeStatus 只修改点赞状态,返回的 bool 表示状态是否变了
+	SetLikeStatus(ctx context.Context, biz string, id int64, uid int64, liked bool) (bool, error)
 	GetLikeInfo(ctx context.Context, biz string, id int64, uid int64) (UserLikeBiz, error)
 	GetCollectInfo(ctx context.Context, biz string, id int64, uid int64) (UserCollectionBiz, error)
 	Get(ctx context.Context, biz string, id int64) (Interactive, error)
@@ -27,23 +50,43 @@ func NewGORMInteractiveDAO(db *gorm.DB) InteractiveDAO {
 	return &GORMInteractiveDAO{db: db}
 }
 
-// IncrReadCnt 增加阅读计数
+// IncrReadCnt 增加阅读计数,原始阅读计数也一起增加
 func (dao *GORMInteractiveDAO) IncrReadCnt(ctx context.Context, biz string, bizId int64) error {
 	now := time.Now().UnixMilli()
 
 	return dao.db.WithContext(ctx).Clauses(clause.OnConflict{
 		// 在发生冲突时,执行更新操作
 		DoUpdates: clause.Assignments(map[string]interface{}{
-			"read_cnt": gorm.Expr("`read_cnt` + 1"),
-			"utime":    now,
+			"read_cnt":     gorm.Expr("`read_cnt` + 1"),
+			"raw_read_cnt": gorm.Expr("`raw_read_cnt` + 1"),
+			"utime":        now,
 		}),
 		// 创建
 	}).Create(&Interactive{
-		Biz:     biz,
-		BizId:   bizId,
-		ReadCnt: 1,
-		Ctime:   now,
-		Utime:   now,
+		Biz:        biz,
+		BizId:      bizId,
+		ReadCnt:    1,
+		RawReadCnt: 1,
+		Ctime:      now,
+		Utime:      now,
+	}).Error
+}
+
+// incrRawReadCnt 只增加原始阅读计数
+func (dao *GORMInteractiveDAO) incrRawReadCnt(ctx context.Context, biz string, bizId int64) error {
+	now := time.Now().UnixMilli()
+
+	return dao.db.WithContext(ctx).Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"raw_read_cnt": gorm.Expr("`raw_read_cnt` + 1"),
+			"utime":        now,
+		}),
+	}).Create(&Interactive{
+		Biz:        biz,
+		BizId:      bizId,
+		RawReadCnt: 1,
+		Ctime:      now,
+		Utime:      now,
 	}).Error
 }
 
@@ -61,77 +104,220 @@ func (dao *GORMInteractiveDAO) BatchIncrReadCnt(ctx context.Context, bizs []stri
 	})
 }
 
-// InsertLikeInfo 插入点赞信息
-func (dao *GORMInteractiveDAO) InsertLikeInfo(ctx context.Context, biz string, id int64, uid int64) error {
+// BatchIncrRawReadCnt 批量增加原始阅读计数
+func (dao *GORMInteractiveDAO) BatchIncrRawReadCnt(ctx context.Context, bizs []string, bizIds []int64) error {
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		txDao := &GORMInteractiveDAO{db: tx}
+		for i := 0; i < len(bizs); i++ {
+			err := txDao.incrRawReadCnt(ctx, bizs[i], bizIds[i])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// BatchIncrCnts 在一个事务里面把增量写回数据库,计数最小是 0
+func (dao *GORMInteractiveDAO) BatchIncrCnts(ctx context.Context, deltas []InteractiveDelta) error {
 	now := time.Now().UnixMilli()
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, d := range deltas {
+			err := tx.Clauses(clause.OnConflict{
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					"read_cnt":     gorm.Expr("GREATEST(`read_cnt` + ?, 0)", d.ReadCnt),
+					"raw_read_cnt": gorm.Expr("GREATEST(`raw_read_cnt` + ?, 0)", d.RawReadCnt),
+					"collect_cnt":  gorm.Expr("GREATEST(`collect_cnt` + ?, 0)", d.CollectCnt),
+					"utime":        now,
+				}),
+			}).Create(&Interactive{
+				Biz:        d.Biz,
+				BizId:      d.BizId,
+				ReadCnt:    max(d.ReadCnt, 0),
+				RawReadCnt: max(d.RawReadCnt, 0),
+				CollectCnt: max(d.CollectCnt, 0),
+				Ctime:      now,
+				Utime:      now,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
 
+// ListLikeChanged 点赞和取消点赞都会更新 utime
+func (dao *GORMInteractiveDAO) ListLikeChanged(ctx context.Context, since int64) ([]UserLikeBiz, error) {
+	var res []UserLikeBiz
+	err := dao.db.WithContext(ctx).Model(&UserLikeBiz{}).
+		Distinct("biz", "biz_id").
+		Where("utime >= ?", since).
+		Find(&res).Error
+	return res, err
+}
+
+// SyncLikeCnts 在一个事务里面把点赞数改成点赞记录的数量
+func (dao *GORMInteractiveDAO) SyncLikeCnts(ctx context.Context, biz []string, bizId []int64) error {
+	now := time.Now().UnixMilli()
 	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		err := tx.Clauses(clause.OnConflict{
-			DoUpdates: clause.Assignments(map[string]interface{}{
-				"utime":  now,
-				"status": 1,
-			}),
-		}).Create(&UserLikeBiz{
+		for i := 0; i < len(biz); i++ {
+			var cnt int64
+			err := tx.Model(&UserLikeBiz{}).
+				Where("biz = ? AND biz_id = ? AND status = ?", biz[i], bizId[i], statusActive).
+				Count(&cnt).Error
+			if err != nil {
+				return err
+			}
+			err = tx.Clauses(clause.OnConflict{
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					"like_cnt": cnt,
+					"utime":    now,
+				}),
+			}).Create(&Interactive{
+				Biz:     biz[i],
+				BizId:   bizId[i],
+				LikeCnt: cnt,
+				Ctime:   now,
+				Utime:   now,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// InsertLikeInfo 插入点赞信息,只有从没点赞变成点赞的时候才增加点赞数
+func (dao *GORMInteractiveDAO) InsertLikeInfo(ctx context.Context, biz string, id int64, uid int64) (bool, error) {
+	return dao.updateLikeStatus(ctx, biz, id, uid, statusActive)
+}
+
+// DeleteLikeInfo 删除点赞信息,只有从点赞变成没点赞的时候才减少点赞数
+func (dao *GORMInteractiveDAO) DeleteLikeInfo(ctx context.Context,
+	biz string, id int64, uid int64) (bool, error) {
+	return dao.updateLikeStatus(ctx, biz, id, uid, statusCanceled)
+}
+
+// SetLikeStatus 只修改点赞状态,不修改点赞数,点赞数由调用者自己累加之后写回
+func (dao *GORMInteractiveDAO) SetLikeStatus(ctx context.Context,
+	biz string, id int64, uid int64, liked bool) (bool, error) {
+	status := statusCanceled
+	if liked {
+		status = statusActive
+	}
+	now := time.Now().UnixMilli()
+	changed := false
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		changed, err = setLikeStatus(tx, biz, id, uid, status, now)
+		return err
+	})
+	return changed, err
+}
+
+// setLikeStatus 锁住点赞记录,比较前后的状态,返回状态是否变了,必须在事务里面调用
+func setLikeStatus(tx *gorm.DB, biz string, id int64, uid int64, status int, now int64) (bool, error) {
+	var ul UserLikeBiz
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("uid = ? AND biz = ? AND biz_id = ?", uid, biz, id).
+		First(&ul).Error
+	switch {
+	case errors.Is(err, ErrRecordNotFound):
+		if status != statusActive {
+			// 从来没点过赞,取消点赞什么也不做
+			return false, nil
+		}
+		err = tx.Create(&UserLikeBiz{
 			Uid:    uid,
 			Biz:    biz,
 			BizId:  id,
-			Status: 1,
+			Status: status,
+			Ctime:  now,
 			Utime:  now,
 		}).Error
-		if err != nil {
-			return err
+		if isDuplicateErr(err) {
+			// 并发的请求已经点赞了
+			return false, nil
 		}
-
-		return tx.WithContext(ctx).Clauses(clause.OnConflict{
-			DoUpdates: clause.Assignments(map[string]interface{}{
-				"like_cnt": gorm.Expr("`like_cnt` + 1"),
-				"utime":    now,
-			}),
-		}).Create(&Interactive{
-			Biz:     biz,
-			BizId:   id,
-			LikeCnt: 1,
-			Ctime:   now,
-			Utime:   now,
+	case err != nil:
+		return false, err
+	case ul.Status == status:
+		// 重复点赞或者重复取消点赞
+		return false, nil
+	default:
+		err = tx.Model(&ul).Updates(map[string]interface{}{
+			"status": status,
+			"utime":  now,
 		}).Error
-
-	})
+	}
+	return err == nil, err
 }
 
-// DeleteLikeInfo 删除点赞信息
-func (dao *GORMInteractiveDAO) DeleteLikeInfo(ctx context.Context,
-	biz string, id int64, uid int64) error {
+// updateLikeStatus 在事务里面锁住点赞记录,比较前后的状态,状态变了才修改点赞数
+func (dao *GORMInteractiveDAO) updateLikeStatus(ctx context.Context,
+	biz string, id int64, uid int64, status int) (bool, error) {
 	now := time.Now().UnixMilli()
-	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		err := tx.Model(&UserLikeBiz{}).
-			Where("uid=? AND biz_id = ? AND biz=?", uid, id, biz).
-			Updates(map[string]interface{}{
-				"utime":  now,
-				"status": 0,
+	changed := false
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		ok, err := setLikeStatus(tx, biz, id, uid, status, now)
+		if err != nil || !ok {
+			return err
+		}
+
+		if status == statusActive {
+			err = tx.Clauses(clause.OnConflict{
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					"like_cnt": gorm.Expr("`like_cnt` + 1"),
+					"utime":    now,
+				}),
+			}).Create(&Interactive{
+				Biz:     biz,
+				BizId:   id,
+				LikeCnt: 1,
+				Ctime:   now,
+				Utime:   now,
 			}).Error
+		} else {
+			err = tx.Model(&Interactive{}).
+				Where("biz = ? AND biz_id = ? AND like_cnt > 0", biz, id).
+				Updates(map[string]interface{}{
+					"like_cnt": gorm.Expr("`like_cnt` - 1"),
+					"utime":    now,
+				}).Error
+		}
 		if err != nil {
 			return err
 		}
-		return tx.Model(&Interactive{}).
-			Where("biz =? AND biz_id=?", biz, id).
-			Updates(map[string]interface{}{
-				"like_cnt": gorm.Expr("`like_cnt` - 1"),
-				"utime":    now,
-			}).Error
+		changed = true
+		return nil
 	})
+	return changed, err
 }
 
-// InsertCollectionBiz 插入收藏信息
-func (dao *GORMInteractiveDAO) InsertCollectionBiz(ctx context.Context, cb UserCollectionBiz) error {
+// InsertCollectionBiz 插入收藏信息,同时增加收藏夹的收藏数量和收藏计数
+// 收藏夹不存在或者不是自己的时候返回 ErrCollectionNotFound
+// 已经收藏过的时候什么也不做,即便 cid 不一样,换收藏夹要走移动收藏
+func (dao *GORMInteractiveDAO) InsertCollectionBiz(ctx context.Context, cb UserCollectionBiz) (bool, error) {
 	now := time.Now().UnixMilli()
 	cb.Ctime = now
 	cb.Utime = now
-	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+	changed := false
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		err := tx.Create(&cb).Error
+		if isDuplicateErr(err) {
+			// 已经收藏过了,或者并发的请求已经收藏了
+			return nil
+		}
 		if err != nil {
 			return err
 		}
-		return tx.WithContext(ctx).Clauses(clause.OnConflict{
+		err = incrCollectionItemCnt(tx, cb.Uid, cb.Cid, 1, now)
+		if err != nil {
+			return err
+		}
+		err = tx.Clauses(clause.OnConflict{
 			DoUpdates: clause.Assignments(map[string]interface{}{
 				"collect_cnt": gorm.Expr("`collect_cnt` + 1"),
 				"utime":       now,
@@ -143,7 +329,54 @@ func (dao *GORMInteractiveDAO) InsertCollectionBiz(ctx context.Context, cb UserC
 			Ctime:      now,
 			Utime:      now,
 		}).Error
+		if err != nil {
+			return err
+		}
+		changed = true
+		return nil
 	})
+	return changed, err
+}
+
+// DeleteCollectionBiz 删除收藏信息,同时减少收藏夹的收藏数量和收藏计数
+func (dao *GORMInteractiveDAO) DeleteCollectionBiz(ctx context.Context,
+	biz string, id int64, uid int64) (bool, error) {
+	now := time.Now().UnixMilli()
+	changed := false
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var cb UserCollectionBiz
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("uid = ? AND biz = ? AND biz_id = ?", uid, biz, id).
+			First(&cb).Error
+		if errors.Is(err, ErrRecordNotFound) {
+			// 没有收藏过,或者已经取消了
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = tx.Delete(&cb).Error
+		if err != nil {
+			return err
+		}
+		err = incrCollectionItemCnt(tx, cb.Uid, cb.Cid, -1, now)
+		// 收藏夹被删除的时候收藏也一起删除了,这里找不到收藏夹说明数据有问题,不影响取消收藏
+		if err != nil && !errors.Is(err, ErrCollectionNotFound) {
+			return err
+		}
+		err = tx.Model(&Interactive{}).
+			Where("biz = ? AND biz_id = ? AND collect_cnt > 0", biz, id).
+			Updates(map[string]interface{}{
+				"collect_cnt": gorm.Expr("`collect_cnt` - 1"),
+				"utime":       now,
+			}).Error
+		if err != nil {
+			return err
+		}
+		changed = true
+		return nil
+	})
+	return changed, err
 }
 
 // GetLikeInfo 获取点赞信息
@@ -152,7 +385,7 @@ func (dao *GORMInteractiveDAO) GetLikeInfo(ctx context.Context, biz string, id i
 
 	err := dao.db.WithContext(ctx).
 		Where("biz = ? AND biz_id = ? AND uid = ? AND status = ?",
-			biz, id, uid, 1).
+			biz, id, uid, statusActive).
 		First(&res).Error
 	return res, err
 }
@@ -185,6 +418,22 @@ func (dao *GORMInteractiveDAO) GetByIds(ctx context.Context, biz string, ids []i
 	return res, err
 }
 
+// isDuplicateErr 是否是唯一索引冲突
+func isDuplicateErr(err error) bool {
+	var me *mysql.MySQLError
+	const duplicateErr uint16 = 1062
+	return errors.As(err, &me) && me.Number == duplicateErr
+}
+
+// InteractiveDelta 计数的增量
+type InteractiveDelta struct {
+	Biz        string
+	BizId      int64
+	ReadCnt    int64
+	RawReadCnt int64
+	CollectCnt int64
+}
+
 // Interactive 交互信息模型
 type Interactive struct {
 	Id int64 `gorm:"primaryKey,autoIncrement"` // 主键,自增
@@ -192,7 +441,8 @@ type Interactive struct {
 	BizId int64  `gorm:"uniqueIndex:biz_type_id"`                   // 业务ID,与Biz组成唯一索引
 	Biz   string `gorm:"type:varchar(128);uniqueIndex:biz_type_id"` // 业务类型,与BizId组成唯一索引
 
-	ReadCnt    int64 // 阅读计数
+	ReadCnt    int64 // 阅读计数,同一个读者在去重窗口内只算一次
+	RawReadCnt int64 // 原始阅读计数,每次阅读都算,用于分析
 	LikeCnt    int64 // 点赞计数
 	CollectCnt int64 // 收藏计数
 	Utime      int64 // 更新时间
@@ -213,13 +463,19 @@ type UserCollectionBiz struct {
 	Ctime int64 // 创建时间
 }
 
+// 点赞和表态的状态
+const (
+	statusCanceled = iota // 取消了
+	statusActive          // 点赞了或者表态了
+)
+
 // UserLikeBiz 用户点赞业务模型
 type UserLikeBiz struct {
-	Id     int64  `gorm:"primaryKey,autoIncrement"`                      // 主键,自增
-	Uid    int64  `gorm:"uniqueIndex:uid_biz_type_id"`                   // 用户ID,与BizId和Biz组成唯一索引
-	BizId  int64  `gorm:"uniqueIndex:uid_biz_type_id"`                   // 业务ID,与Uid和Biz组成唯一索引
-	Biz    string `gorm:"type:varchar(128);uniqueIndex:uid_biz_type_id"` // 业务类型,与Uid和BizId组成唯一索引
-	Status int    // 状态
-	Utime  int64  // 更新时间
+	Id     int64  `gorm:"primaryKey,autoIncrement"`                                               // 主键,自增
+	Uid    int64  `gorm:"uniqueIndex:uid_biz_type_id"`                                            // 用户ID,与BizId和Biz组成唯一索引
+	BizId  int64  `gorm:"uniqueIndex:uid_biz_type_id;index:biz_type_id_status"`                   // 业务ID,与Uid和Biz组成唯一索引
+	Biz    string `gorm:"type:varchar(128);uniqueIndex:uid_biz_type_id;index:biz_type_id_status"` // 业务类型,与Uid和BizId组成唯一索引
+	Status int    `gorm:"index:biz_type_id_status"`                                               // 状态,biz_type_id_status 用于重新计算点赞数
+	Utime  int64  `gorm:"index"`                                                                  // 更新时间,用于找出点赞状态变过的资源
 	Ctime  int64  // 创建时间
 }
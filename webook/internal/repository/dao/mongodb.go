@@ -138,6 +138,18 @@ func (m *MongoDBArticleDAO) GetPubById(ctx context.Context, id int64) (Published
 	panic("implement me")
 }
 
+// GetPubByIds 根据 ID 批量获取已发布的文章
+func (m *MongoDBArticleDAO) GetPubByIds(ctx context.Context, ids []int64) ([]PublishedArticle, error) {
+	filter := bson.D{bson.E{Key: "id", Value: bson.D{bson.E{Key: "$in", Value: ids}}}}
+	cursor, err := m.liveCol.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var res []PublishedArticle
+	err = cursor.All(ctx, &res)
+	return res, err
+}
+
 func (m *MongoDBArticleDAO) ListPub(ctx context.Context, start time.Time, offset int, limit int) ([]PublishedArticle, error) {
 	//TODO implement me
 	panic("implement me")
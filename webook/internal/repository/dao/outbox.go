@@ -0,0 +1,109 @@
+package dao
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"time"
+)
+
+type OutboxDAO interface {
+	Insert(ctx context.Context, evt OutboxEvent) error
+	FindPending(ctx context.Context, limit int) ([]OutboxEvent, error)
+	MarkSent(ctx context.Context, ids []int64) error
+	MarkFailed(ctx context.Context, id int64) error
+	IncrRetries(ctx context.Context, id int64) error
+	DeleteSentBefore(ctx context.Context, t time.Time, limit int) (int64, error)
+}
+
+// GORMOutboxDAO 基于 GORM 的 outbox 实现
+// 需要和业务数据在同一个事务里面写入事件的时候,用事务的 tx 创建一个 GORMOutboxDAO 就可以
+type GORMOutboxDAO struct {
+	db *gorm.DB
+}
+
+func NewGORMOutboxDAO(db *gorm.DB) OutboxDAO {
+	return &GORMOutboxDAO{db: db}
+}
+
+// Insert 写入一条待发送的事件
+func (dao *GORMOutboxDAO) Insert(ctx context.Context, evt OutboxEvent) error {
+	now := time.Now().UnixMilli()
+	evt.Status = outboxStatusPending
+	evt.Ctime = now
+	evt.Utime = now
+	return dao.db.WithContext(ctx).Create(&evt).Error
+}
+
+// FindPending 按照写入的顺序找出待发送的事件
+func (dao *GORMOutboxDAO) FindPending(ctx context.Context, limit int) ([]OutboxEvent, error) {
+	var res []OutboxEvent
+	err := dao.db.WithContext(ctx).
+		Where("status = ?", outboxStatusPending).
+		Order("id").Limit(limit).Find(&res).Error
+	return res, err
+}
+
+// MarkSent 标记为已经发送
+func (dao *GORMOutboxDAO) MarkSent(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return dao.db.WithContext(ctx).Model(&OutboxEvent{}).
+		Where("id IN ?", ids).Updates(map[string]any{
+		"status": outboxStatusSent,
+		"utime":  time.Now().UnixMilli(),
+	}).Error
+}
+
+// MarkFailed 标记为发送失败,不会再发送,需要人工处理
+func (dao *GORMOutboxDAO) MarkFailed(ctx context.Context, id int64) error {
+	return dao.db.WithContext(ctx).Model(&OutboxEvent{}).
+		Where("id = ?", id).Updates(map[string]any{
+		"status": outboxStatusFailed,
+		"utime":  time.Now().UnixMilli(),
+	}).Error
+}
+
+// IncrRetries 记录一次发送失败,下一轮还会继续发送
+func (dao *GORMOutboxDAO) IncrRetries(ctx context.Context, id int64) error {
+	return dao.db.WithContext(ctx).Model(&OutboxEvent{}).
+		Where("id = ?", id).Updates(map[string]any{
+		"retries": gorm.Expr("`retries` + 1"),
+		"utime":   time.Now().UnixMilli(),
+	}).Error
+}
+
+// DeleteSentBefore 删除 t 之前已经发送的事件,一次最多删除 limit 条,返回删除的条数
+func (dao *GORMOutboxDAO) DeleteSentBefore(ctx context.Context, t time.Time, limit int) (int64, error) {
+	db := dao.db.WithContext(ctx)
+	var ids []int64
+	err := db.Model(&OutboxEvent{}).
+		Where("status = ? AND utime < ?", outboxStatusSent, t.UnixMilli()).
+		Order("id").Limit(limit).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	res := db.Where("id IN ?", ids).Delete(&OutboxEvent{})
+	return res.RowsAffected, res.Error
+}
+
+// OutboxEvent 待发送的事件
+type OutboxEvent struct {
+	Id      int64  `gorm:"primaryKey,autoIncrement"`
+	Topic   string `gorm:"type:varchar(128)"`
+	Payload []byte `gorm:"type:blob"`
+	// 按照状态查找待发送的,按照状态和更新时间清理已经发送的
+	Status  uint8 `gorm:"index:idx_status_utime"`
+	Retries int
+	Utime   int64 `gorm:"index:idx_status_utime"`
+	Ctime   int64
+}
+
+const (
+	// outboxStatusPending 等待发送
+	outboxStatusPending uint8 = iota + 1
+	// outboxStatusSent 已经发送
+	outboxStatusSent
+	// outboxStatusFailed 事件本身有问题,发送不了,需要人工处理
+	outboxStatusFailed
+)
@@ -0,0 +1,147 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// InsertReaction 表态,只有从没表态变成表态的时候才增加这种表态的数量
+func (dao *GORMInteractiveDAO) InsertReaction(ctx context.Context,
+	biz string, id int64, uid int64, reaction string) (bool, error) {
+	return dao.updateReactionStatus(ctx, biz, id, uid, reaction, statusActive)
+}
+
+// DeleteReaction 取消表态,只有从表态变成没表态的时候才减少这种表态的数量
+func (dao *GORMInteractiveDAO) DeleteReaction(ctx context.Context,
+	biz string, id int64, uid int64, reaction string) (bool, error) {
+	return dao.updateReactionStatus(ctx, biz, id, uid, reaction, statusCanceled)
+}
+
+// updateReactionStatus 和点赞一样,在事务里面锁住表态记录,状态变了才修改数量
+func (dao *GORMInteractiveDAO) updateReactionStatus(ctx context.Context,
+	biz string, id int64, uid int64, reaction string, status int) (bool, error) {
+	now := time.Now().UnixMilli()
+	changed := false
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var ur UserReactionBiz
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("uid = ? AND biz = ? AND biz_id = ? AND reaction = ?", uid, biz, id, reaction).
+			First(&ur).Error
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			if status != statusActive {
+				return nil
+			}
+			err = tx.Create(&UserReactionBiz{
+				Uid:      uid,
+				Biz:      biz,
+				BizId:    id,
+				Reaction: reaction,
+				Status:   status,
+				Ctime:    now,
+				Utime:    now,
+			}).Error
+			if isDuplicateErr(err) {
+				return nil
+			}
+		case err != nil:
+			return err
+		case ur.Status == status:
+			return nil
+		default:
+			err = tx.Model(&ur).Updates(map[string]interface{}{
+				"status": status,
+				"utime":  now,
+			}).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		if status == statusActive {
+			err = tx.Clauses(clause.OnConflict{
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					"cnt":   gorm.Expr("`cnt` + 1"),
+					"utime": now,
+				}),
+			}).Create(&ReactionCnt{
+				Biz:      biz,
+				BizId:    id,
+				Reaction: reaction,
+				Cnt:      1,
+				Ctime:    now,
+				Utime:    now,
+			}).Error
+		} else {
+			err = tx.Model(&ReactionCnt{}).
+				Where("biz = ? AND biz_id = ? AND reaction = ? AND cnt > 0", biz, id, reaction).
+				Updates(map[string]interface{}{
+					"cnt":   gorm.Expr("`cnt` - 1"),
+					"utime": now,
+				}).Error
+		}
+		if err != nil {
+			return err
+		}
+		changed = true
+		return nil
+	})
+	return changed, err
+}
+
+// GetReactionCnts 获取每种表态的数量
+func (dao *GORMInteractiveDAO) GetReactionCnts(ctx context.Context,
+	biz string, id int64) ([]ReactionCnt, error) {
+	var res []ReactionCnt
+	err := dao.db.WithContext(ctx).
+		Where("biz = ? AND biz_id = ?", biz, id).
+		Find(&res).Error
+	return res, err
+}
+
+// GetReactionCntsByIds 批量获取每种表态的数量
+func (dao *GORMInteractiveDAO) GetReactionCntsByIds(ctx context.Context,
+	biz string, ids []int64) ([]ReactionCnt, error) {
+	var res []ReactionCnt
+	err := dao.db.WithContext(ctx).
+		Where("biz = ? AND biz_id IN ?", biz, ids).
+		Find(&res).Error
+	return res, err
+}
+
+// GetUserReactions 获取用户当前的表态
+func (dao *GORMInteractiveDAO) GetUserReactions(ctx context.Context,
+	biz string, id int64, uid int64) ([]UserReactionBiz, error) {
+	var res []UserReactionBiz
+	err := dao.db.WithContext(ctx).
+		Where("biz = ? AND biz_id = ? AND uid = ? AND status = ?", biz, id, uid, statusActive).
+		Find(&res).Error
+	return res, err
+}
+
+// UserReactionBiz 用户的表态,一个用户对同一个资源可以有多种表态
+// 点赞依旧保存在 UserLikeBiz 里面
+type UserReactionBiz struct {
+	Id       int64  `gorm:"primaryKey,autoIncrement"`
+	Uid      int64  `gorm:"uniqueIndex:uid_biz_type_id_reaction"`
+	BizId    int64  `gorm:"uniqueIndex:uid_biz_type_id_reaction"`
+	Biz      string `gorm:"type:varchar(128);uniqueIndex:uid_biz_type_id_reaction"`
+	Reaction string `gorm:"type:varchar(32);uniqueIndex:uid_biz_type_id_reaction"`
+	Status   int
+	Utime    int64
+	Ctime    int64
+}
+
+// ReactionCnt 每种表态的数量,点赞的数量依旧是 Interactive 的 LikeCnt
+type ReactionCnt struct {
+	Id       int64  `gorm:"primaryKey,autoIncrement"`
+	BizId    int64  `gorm:"uniqueIndex:biz_type_id_reaction"`
+	Biz      string `gorm:"type:varchar(128);uniqueIndex:biz_type_id_reaction"`
+	Reaction string `gorm:"type:varchar(32);uniqueIndex:biz_type_id_reaction"`
+	Cnt      int64
+	Utime    int64
+	Ctime    int64
+}
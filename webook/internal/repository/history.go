@@ -2,9 +2,125 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"github.com/ClearloveHn/golangwebook/webook/internal/domain"
+	"github.com/ClearloveHn/golangwebook/webook/internal/repository/dao"
+	"github.com/ecodeclub/ekit/slice"
+	"time"
 )
 
+// ErrInvalidHistoryUser 没有登录的用户没有浏览记录
+var ErrInvalidHistoryUser = errors.New("浏览记录的用户 ID 不合法")
+
 type HistoryRecordRepository interface {
 	AddRecord(ctx context.Context, record domain.HistoryRecord) error
+	// List 按照浏览时间倒序查询,cursor 是上一页最后一条记录,第一页传零值
+	List(ctx context.Context, uid int64, cursor domain.HistoryCursor, limit int) ([]domain.HistoryRecord, error)
+	Delete(ctx context.Context, uid int64, id int64) error
+	Clear(ctx context.Context, uid int64) error
+	// UpdateProgress 保存最新的阅读进度
+	UpdateProgress(ctx context.Context, p domain.ReadProgress) error
+	// ListUnfinished 继续阅读的列表
+	ListUnfinished(ctx context.Context, uid int64, limit int) ([]domain.HistoryRecord, error)
+	// CompletionRates 平均完成率,0 到 100,没有读者上报过进度的不会出现在结果里面
+	CompletionRates(ctx context.Context, biz string, bizIds []int64) (map[int64]float64, error)
+}
+
+type GORMHistoryRecordRepository struct {
+	dao dao.HistoryRecordDAO
+}
+
+func NewGORMHistoryRecordRepository(dao dao.HistoryRecordDAO) HistoryRecordRepository {
+	return &GORMHistoryRecordRepository{dao: dao}
+}
+
+// AddRecord 浏览过的只更新浏览时间
+func (r *GORMHistoryRecordRepository) AddRecord(ctx context.Context, record domain.HistoryRecord) error {
+	if record.Uid <= 0 {
+		return ErrInvalidHistoryUser
+	}
+	return r.dao.Upsert(ctx, dao.HistoryRecord{
+		Uid:   record.Uid,
+		Biz:   record.Biz,
+		BizId: record.BizId,
+	})
+}
+
+func (r *GORMHistoryRecordRepository) List(ctx context.Context, uid int64,
+	cursor domain.HistoryCursor, limit int) ([]domain.HistoryRecord, error) {
+	var utime int64
+	if !cursor.Utime.IsZero() {
+		utime = cursor.Utime.UnixMilli()
+	}
+	records, err := r.dao.List(ctx, uid, utime, cursor.Id, limit)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map[dao.HistoryRecord, domain.HistoryRecord](records,
+		func(idx int, src dao.HistoryRecord) domain.HistoryRecord {
+			return r.toDomain(src)
+		}), nil
+}
+
+func (r *GORMHistoryRecordRepository) Delete(ctx context.Context, uid int64, id int64) error {
+	return r.dao.Delete(ctx, uid, id)
+}
+
+func (r *GORMHistoryRecordRepository) Clear(ctx context.Context, uid int64) error {
+	return r.dao.DeleteByUid(ctx, uid)
+}
+
+func (r *GORMHistoryRecordRepository) UpdateProgress(ctx context.Context, p domain.ReadProgress) error {
+	return r.dao.UpdateProgress(ctx, dao.HistoryRecord{
+		Uid:      p.Uid,
+		Biz:      p.Biz,
+		BizId:    p.BizId,
+		Position: p.Position,
+		Progress: p.Progress,
+	}, p.Duration.Milliseconds())
+}
+
+func (r *GORMHistoryRecordRepository) ListUnfinished(ctx context.Context,
+	uid int64, limit int) ([]domain.HistoryRecord, error) {
+	records, err := r.dao.ListUnfinished(ctx, uid, domain.FinishedProgress, limit)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map[dao.HistoryRecord, domain.HistoryRecord](records,
+		func(idx int, src dao.HistoryRecord) domain.HistoryRecord {
+			return r.toDomain(src)
+		}), nil
+}
+
+func (r *GORMHistoryRecordRepository) CompletionRates(ctx context.Context,
+	biz string, bizIds []int64) (map[int64]float64, error) {
+	if len(bizIds) == 0 {
+		return map[int64]float64{}, nil
+	}
+	stats, err := r.dao.GetProgressStats(ctx, biz, bizIds)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[int64]float64, len(stats))
+	for _, s := range stats {
+		if s.ReaderCnt > 0 {
+			res[s.BizId] = float64(s.ProgressSum) / float64(s.ReaderCnt)
+		}
+	}
+	return res, nil
+}
+
+func (r *GORMHistoryRecordRepository) toDomain(src dao.HistoryRecord) domain.HistoryRecord {
+	return domain.HistoryRecord{
+		Id:          src.Id,
+		Uid:         src.Uid,
+		Biz:         src.Biz,
+		BizId:       src.BizId,
+		Position:    src.Position,
+		Progress:    src.Progress,
+		MaxProgress: src.MaxProgress,
+		Duration:    time.Duration(src.Duration) * time.Millisecond,
+		Ctime:       time.UnixMilli(src.Ctime),
+		Utime:       time.UnixMilli(src.Utime),
+	}
 }
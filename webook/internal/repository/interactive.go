@@ -6,21 +6,34 @@ import (
 	"github.com/ClearloveHn/golangwebook/webook/internal/domain"
 	"github.com/ClearloveHn/golangwebook/webook/internal/repository/cache"
 	"github.com/ClearloveHn/golangwebook/webook/internal/repository/dao"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
 	"github.com/ecodeclub/ekit/slice"
-	"gorm.io/gorm/logger"
 )
 
 type InteractiveRepository interface {
 	IncrReadCnt(ctx context.Context, biz string, bizId int64) error
 	// BatchIncrReadCnt biz 和 bizId 长度必须一致
 	BatchIncrReadCnt(ctx context.Context, biz []string, bizId []int64) error
+	// BatchIncrRawReadCnt 只增加原始阅读数,缓存里面没有原始阅读数,所以只更新数据库
+	BatchIncrRawReadCnt(ctx context.Context, biz []string, bizId []int64) error
 	IncrLike(ctx context.Context, biz string, id int64, uid int64) error
 	DecrLike(ctx context.Context, biz string, id int64, uid int64) error
+	// AddCollectionItem 和 DeleteCollectionItem 都是幂等的,重复调用不会重复计数
 	AddCollectionItem(ctx context.Context, biz string, id int64, cid int64, uid int64) error
+	DeleteCollectionItem(ctx context.Context, biz string, id int64, uid int64) error
+	// IncrReaction 和 DecrReaction 是幂等的,点赞要用 IncrLike 和 DecrLike
+	IncrReaction(ctx context.Context, biz string, id int64, uid int64, reaction string) error
+	DecrReaction(ctx context.Context, biz string, id int64, uid int64, reaction string) error
+	// Get 返回的 Reactions 里面没有点赞
 	Get(ctx context.Context, biz string, id int64) (domain.Interactive, error)
+	// Reactions 用户当前的表态,不包括点赞
+	Reactions(ctx context.Context, biz string, id int64, uid int64) ([]string, error)
 	Liked(ctx context.Context, biz string, id int64, uid int64) (bool, error)
 	Collected(ctx context.Context, biz string, id int64, uid int64) (bool, error)
 	GetByIds(ctx context.Context, biz string, ids []int64) ([]domain.Interactive, error)
+	// FlushCounters 把暂存的计数增量写回数据库,返回写回了多少个资源的计数
+	// 直接写数据库的模式下什么也不做
+	FlushCounters(ctx context.Context) (int, error)
 }
 
 type CachedInteractiveRepository struct {
@@ -63,20 +76,25 @@ func (c *CachedInteractiveRepository) BatchIncrReadCnt(ctx context.Context, biz
 	return nil
 }
 
-// IncrLike 增加点赞
+// BatchIncrRawReadCnt 批量增加原始阅读数
+func (c *CachedInteractiveRepository) BatchIncrRawReadCnt(ctx context.Context, biz []string, bizId []int64) error {
+	return c.dao.BatchIncrRawReadCnt(ctx, biz, bizId)
+}
+
+// IncrLike 增加点赞,重复点赞不会重复计数
 func (c *CachedInteractiveRepository) IncrLike(ctx context.Context, biz string, id int64, uid int64) error {
-	err := c.dao.InsertLikeInfo(ctx, biz, id, uid)
-	if err != nil {
+	changed, err := c.dao.InsertLikeInfo(ctx, biz, id, uid)
+	if err != nil || !changed {
 		return err
 	}
 
 	return c.cache.IncrLikeCntIfPresent(ctx, biz, id)
 }
 
-// DecrLike 取消点赞
+// DecrLike 取消点赞,没有点赞过的时候什么也不做
 func (c *CachedInteractiveRepository) DecrLike(ctx context.Context, biz string, id int64, uid int64) error {
-	err := c.dao.DeleteLikeInfo(ctx, biz, id, uid)
-	if err != nil {
+	changed, err := c.dao.DeleteLikeInfo(ctx, biz, id, uid)
+	if err != nil || !changed {
 		return err
 	}
 
@@ -87,19 +105,52 @@ func (c *CachedInteractiveRepository) DecrLike(ctx context.Context, biz string,
 func (c *CachedInteractiveRepository) AddCollectionItem(ctx context.Context,
 	biz string, id int64, cid int64, uid int64) error {
 
-	err := c.dao.InsertCollectionBiz(ctx, dao.UserCollectionBiz{
+	changed, err := c.dao.InsertCollectionBiz(ctx, dao.UserCollectionBiz{
 		Biz:   biz,
 		BizId: id,
 		Cid:   cid,
 		Uid:   uid,
 	})
-	if err != nil {
+	if err != nil || !changed {
 		return err
 	}
 
 	return c.cache.IncrCollectCntIfPresent(ctx, biz, id)
 }
 
+// DeleteCollectionItem 取消收藏
+func (c *CachedInteractiveRepository) DeleteCollectionItem(ctx context.Context,
+	biz string, id int64, uid int64) error {
+	changed, err := c.dao.DeleteCollectionBiz(ctx, biz, id, uid)
+	if err != nil || !changed {
+		return err
+	}
+
+	return c.cache.DecrCollectCntIfPresent(ctx, biz, id)
+}
+
+// IncrReaction 表态
+func (c *CachedInteractiveRepository) IncrReaction(ctx context.Context,
+	biz string, id int64, uid int64, reaction string) error {
+	changed, err := c.dao.InsertReaction(ctx, biz, id, uid, reaction)
+	if err != nil || !changed {
+		return err
+	}
+
+	return c.cache.IncrReactionCntIfPresent(ctx, biz, id, reaction)
+}
+
+// DecrReaction 取消表态
+func (c *CachedInteractiveRepository) DecrReaction(ctx context.Context,
+	biz string, id int64, uid int64, reaction string) error {
+	changed, err := c.dao.DeleteReaction(ctx, biz, id, uid, reaction)
+	if err != nil || !changed {
+		return err
+	}
+
+	return c.cache.DecrReactionCntIfPresent(ctx, biz, id, reaction)
+}
+
 func (c *CachedInteractiveRepository) Get(ctx context.Context, biz string, id int64) (domain.Interactive, error) {
 	intr, err := c.cache.Get(ctx, biz, id)
 	if err == nil {
@@ -109,18 +160,34 @@ func (c *CachedInteractiveRepository) Get(ctx context.Context, biz string, id in
 	if err != nil {
 		return domain.Interactive{}, err
 	}
-	if err == nil {
-		res := c.toDomain(ie)
-		err = c.cache.Set(ctx, biz, id, res)
-		if err != nil {
-			c.l.Error("回写缓存失败",
-				logger.String("biz", biz),
-				logger.Int64("bizId", id),
-				logger.Error(err))
-		}
-		return res, nil
+	rcs, err := c.dao.GetReactionCnts(ctx, biz, id)
+	if err != nil {
+		return domain.Interactive{}, err
+	}
+	res := c.toDomain(ie)
+	res.Reactions = make(map[string]int64, len(rcs))
+	for _, rc := range rcs {
+		res.Reactions[rc.Reaction] = rc.Cnt
+	}
+	err = c.cache.Set(ctx, biz, id, res)
+	if err != nil {
+		c.l.Error("回写缓存失败",
+			logger.String("biz", biz),
+			logger.Int64("bizId", id),
+			logger.Error(err))
 	}
-	return intr, err
+	return res, nil
+}
+
+func (c *CachedInteractiveRepository) Reactions(ctx context.Context,
+	biz string, id int64, uid int64) ([]string, error) {
+	urs, err := c.dao.GetUserReactions(ctx, biz, id, uid)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map(urs, func(idx int, src dao.UserReactionBiz) string {
+		return src.Reaction
+	}), nil
 }
 
 func (c *CachedInteractiveRepository) Liked(ctx context.Context,
@@ -154,22 +221,45 @@ func (c *CachedInteractiveRepository) Collected(ctx context.Context,
 	}
 }
 
+// GetByIds 和 Get 一样带上每种表态的数量
 func (c *CachedInteractiveRepository) GetByIds(ctx context.Context, biz string, ids []int64) ([]domain.Interactive, error) {
-
 	intrs, err := c.dao.GetByIds(ctx, biz, ids)
 	if err != nil {
 		return nil, err
 	}
+	rcs, err := c.dao.GetReactionCntsByIds(ctx, biz, ids)
+	if err != nil {
+		return nil, err
+	}
+	reactions := make(map[int64]map[string]int64, len(intrs))
+	for _, rc := range rcs {
+		m, ok := reactions[rc.BizId]
+		if !ok {
+			m = make(map[string]int64)
+			reactions[rc.BizId] = m
+		}
+		m[rc.Reaction] = rc.Cnt
+	}
 
 	return slice.Map(intrs, func(idx int, src dao.Interactive) domain.Interactive {
-		return c.toDomain(src)
+		res := c.toDomain(src)
+		res.Reactions = reactions[src.BizId]
+		if res.Reactions == nil {
+			res.Reactions = map[string]int64{}
+		}
+		return res
 	}), nil
 }
 
+func (c *CachedInteractiveRepository) FlushCounters(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
 func (c *CachedInteractiveRepository) toDomain(ie dao.Interactive) domain.Interactive {
 	return domain.Interactive{
 		BizId:      ie.BizId,
 		ReadCnt:    ie.ReadCnt,
+		RawReadCnt: ie.RawReadCnt,
 		LikeCnt:    ie.LikeCnt,
 		CollectCnt: ie.CollectCnt,
 	}
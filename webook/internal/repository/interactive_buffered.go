@@ -0,0 +1,224 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/ClearloveHn/golangwebook/webook/internal/domain"
+	"github.com/ClearloveHn/golangwebook/webook/internal/repository/cache"
+	"github.com/ClearloveHn/golangwebook/webook/internal/repository/dao"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
+	"github.com/ecodeclub/ekit/slice"
+	"sync"
+	"time"
+)
+
+const (
+	// CounterModeDirect 每次阅读、点赞都直接更新数据库
+	CounterModeDirect = "direct"
+	// CounterModeBuffered 阅读数和点赞数先累加到 Redis,再由 job.InteractiveFlushJob 定期批量写回
+	CounterModeBuffered = "buffered"
+)
+
+const (
+	// likeResyncWindow 刚启动的时候不知道上一次写回到哪里了,重新计算这段时间里面点赞状态变过的资源
+	likeResyncWindow = time.Hour
+	// likeResyncMargin 点赞记录的 utime 是在事务提交之前算的,往前多算一点,避免漏掉提交得慢的事务
+	likeResyncMargin = time.Minute
+)
+
+// InteractiveCounterConfig 计数的写入方式
+type InteractiveCounterConfig struct {
+	// Mode 默认是 direct
+	Mode string `yaml:"mode"`
+	// BatchSize 写回的时候一个事务里面最多更新多少个资源的计数
+	BatchSize int `yaml:"batchSize"`
+}
+
+// NewInteractiveRepository 根据配置选择直接写数据库还是先累加再写回
+func NewInteractiveRepository(dao dao.InteractiveDAO, l logger.LoggerV1,
+	cache cache.InteractiveCache, deltaCache cache.InteractiveDeltaCache,
+	cfg InteractiveCounterConfig) (InteractiveRepository, error) {
+	switch cfg.Mode {
+	case "", CounterModeDirect:
+		return NewCachedInteractiveRepository(dao, l, cache), nil
+	case CounterModeBuffered:
+		return NewBufferedInteractiveRepository(dao, l, cache, deltaCache, cfg.BatchSize), nil
+	default:
+		return nil, fmt.Errorf("未知的计数写入方式 %s", cfg.Mode)
+	}
+}
+
+// BufferedInteractiveRepository 阅读数和点赞数延迟写回数据库,避免热门文章的 interactives 记录成为热点。
+// 阅读数先累加到 Redis,定期合并之后写回;
+// 点赞记录依旧是同步写数据库的,点赞数在写回的时候按照点赞状态变过的点赞记录重新计算,
+// 这样点赞之后进程崩溃或者 Redis 出错都不会让点赞数和点赞记录不一致。
+// 收藏和表态量不大,还是直接写数据库。
+// 缓存里面的计数依旧是实时更新的,缓存过期之后从数据库加载的计数会少掉还没有写回的部分,
+// 所以写回之后会删除这些资源的缓存
+type BufferedInteractiveRepository struct {
+	*CachedInteractiveRepository
+	deltaCache cache.InteractiveDeltaCache
+	batchSize  int
+
+	mu sync.Mutex
+	// likeSince 下一次从这个时间开始找点赞状态变过的资源,毫秒
+	likeSince int64
+}
+
+func NewBufferedInteractiveRepository(dao dao.InteractiveDAO, l logger.LoggerV1,
+	cache cache.InteractiveCache, deltaCache cache.InteractiveDeltaCache,
+	batchSize int) *BufferedInteractiveRepository {
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	return &BufferedInteractiveRepository{
+		CachedInteractiveRepository: &CachedInteractiveRepository{dao: dao, cache: cache, l: l},
+		deltaCache:                  deltaCache,
+		batchSize:                   batchSize,
+		likeSince:                   time.Now().Add(-likeResyncWindow).UnixMilli(),
+	}
+}
+
+func (b *BufferedInteractiveRepository) IncrReadCnt(ctx context.Context, biz string, bizId int64) error {
+	err := b.deltaCache.Incr(ctx, []domain.InteractiveDelta{
+		{Biz: biz, BizId: bizId, ReadCnt: 1, RawReadCnt: 1},
+	})
+	if err != nil {
+		return err
+	}
+	return b.cache.IncrReadCntIfPresent(ctx, biz, bizId)
+}
+
+func (b *BufferedInteractiveRepository) BatchIncrReadCnt(ctx context.Context, biz []string, bizId []int64) error {
+	deltas := make([]domain.InteractiveDelta, 0, len(biz))
+	for i := 0; i < len(biz); i++ {
+		deltas = append(deltas, domain.InteractiveDelta{
+			Biz: biz[i], BizId: bizId[i], ReadCnt: 1, RawReadCnt: 1,
+		})
+	}
+	err := b.deltaCache.Incr(ctx, deltas)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < len(biz); i++ {
+		er := b.cache.IncrReadCntIfPresent(ctx, biz[i], bizId[i])
+		if er != nil {
+			b.l.Error("更新缓存的阅读数失败",
+				logger.String("biz", biz[i]),
+				logger.Int64("bizId", bizId[i]),
+				logger.Error(er))
+		}
+	}
+	return nil
+}
+
+func (b *BufferedInteractiveRepository) BatchIncrRawReadCnt(ctx context.Context, biz []string, bizId []int64) error {
+	deltas := make([]domain.InteractiveDelta, 0, len(biz))
+	for i := 0; i < len(biz); i++ {
+		deltas = append(deltas, domain.InteractiveDelta{Biz: biz[i], BizId: bizId[i], RawReadCnt: 1})
+	}
+	return b.deltaCache.Incr(ctx, deltas)
+}
+
+// IncrLike 点赞记录的 utime 就是点赞数要重新计算的标记,所以这里不需要累加增量
+func (b *BufferedInteractiveRepository) IncrLike(ctx context.Context, biz string, id int64, uid int64) error {
+	changed, err := b.dao.SetLikeStatus(ctx, biz, id, uid, true)
+	if err != nil || !changed {
+		return err
+	}
+	return b.cache.IncrLikeCntIfPresent(ctx, biz, id)
+}
+
+func (b *BufferedInteractiveRepository) DecrLike(ctx context.Context, biz string, id int64, uid int64) error {
+	changed, err := b.dao.SetLikeStatus(ctx, biz, id, uid, false)
+	if err != nil || !changed {
+		return err
+	}
+	return b.cache.DecrLikeCntIfPresent(ctx, biz, id)
+}
+
+// FlushCounters 取出暂存的增量,一批一个事务写回数据库,每写回一批就从 Redis 里面删除这一批,
+// 然后重新计算点赞状态变过的资源的点赞数。
+// 中途失败的时候剩下的增量留在 Redis 里面,下一次写回的时候继续。
+// 返回的是写回了增量的资源数量,不包括重新计算点赞数的资源,
+// 不然 job.InteractiveFlushJob 会因为 likeResyncMargin 里面的资源一直重复计算
+func (b *BufferedInteractiveRepository) FlushCounters(ctx context.Context) (int, error) {
+	deltas, err := b.deltaCache.Claim(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for start := 0; start < len(deltas); start += b.batchSize {
+		end := min(start+b.batchSize, len(deltas))
+		batch := deltas[start:end]
+		err = b.dao.BatchIncrCnts(ctx, slice.Map(batch,
+			func(idx int, src domain.InteractiveDelta) dao.InteractiveDelta {
+				return dao.InteractiveDelta{
+					Biz:        src.Biz,
+					BizId:      src.BizId,
+					ReadCnt:    src.ReadCnt,
+					RawReadCnt: src.RawReadCnt,
+					CollectCnt: src.CollectCnt,
+				}
+			}))
+		if err != nil {
+			return total, err
+		}
+		err = b.deltaCache.Ack(ctx, batch)
+		if err != nil {
+			// 数据库已经写进去了,这一批在下一次写回的时候会重复计算
+			b.l.Error("删除已经写回的计数增量失败", logger.Int("cnt", len(batch)), logger.Error(err))
+			return total, err
+		}
+		for _, d := range batch {
+			b.delCache(ctx, d.Biz, d.BizId)
+		}
+		total += len(batch)
+	}
+	return total, b.resyncLikeCnts(ctx)
+}
+
+// resyncLikeCnts 重新计算 likeSince 之后点赞状态变过的资源的点赞数,全部成功之后才往后推 likeSince
+func (b *BufferedInteractiveRepository) resyncLikeCnts(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	likes, err := b.dao.ListLikeChanged(ctx, b.likeSince)
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(likes); start += b.batchSize {
+		end := min(start+b.batchSize, len(likes))
+		batch := likes[start:end]
+		bizs := make([]string, 0, len(batch))
+		bizIds := make([]int64, 0, len(batch))
+		for _, like := range batch {
+			bizs = append(bizs, like.Biz)
+			bizIds = append(bizIds, like.BizId)
+		}
+		err = b.dao.SyncLikeCnts(ctx, bizs, bizIds)
+		if err != nil {
+			return err
+		}
+		for _, like := range batch {
+			b.delCache(ctx, like.Biz, like.BizId)
+		}
+	}
+	b.likeSince = now.Add(-likeResyncMargin).UnixMilli()
+	return nil
+}
+
+// delCache 缓存里面的计数可能是写回之前从数据库加载的,少了写回的部分,删掉之后重新加载
+func (b *BufferedInteractiveRepository) delCache(ctx context.Context, biz string, bizId int64) {
+	err := b.cache.Del(ctx, biz, bizId)
+	if err != nil {
+		// 缓存过期之后就对了
+		b.l.Error("写回之后删除交互数据缓存失败",
+			logger.String("biz", biz),
+			logger.Int64("bizId", bizId),
+			logger.Error(err))
+	}
+}
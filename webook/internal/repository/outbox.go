@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"github.com/ClearloveHn/golangwebook/webook/internal/domain"
+	"github.com/ClearloveHn/golangwebook/webook/internal/repository/dao"
+	"github.com/ecodeclub/ekit/slice"
+	"time"
+)
+
+type OutboxRepository interface {
+	Add(ctx context.Context, evt domain.OutboxEvent) error
+	FindPending(ctx context.Context, limit int) ([]domain.OutboxEvent, error)
+	MarkSent(ctx context.Context, ids []int64) error
+	MarkFailed(ctx context.Context, id int64) error
+	IncrRetries(ctx context.Context, id int64) error
+	DeleteSentBefore(ctx context.Context, t time.Time, limit int) (int64, error)
+}
+
+type GORMOutboxRepository struct {
+	dao dao.OutboxDAO
+}
+
+func NewGORMOutboxRepository(dao dao.OutboxDAO) OutboxRepository {
+	return &GORMOutboxRepository{dao: dao}
+}
+
+// Add 写入一条待发送的事件
+func (r *GORMOutboxRepository) Add(ctx context.Context, evt domain.OutboxEvent) error {
+	return r.dao.Insert(ctx, dao.OutboxEvent{
+		Topic:   evt.Topic,
+		Payload: evt.Payload,
+	})
+}
+
+// FindPending 找出待发送的事件
+func (r *GORMOutboxRepository) FindPending(ctx context.Context, limit int) ([]domain.OutboxEvent, error) {
+	evts, err := r.dao.FindPending(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map[dao.OutboxEvent, domain.OutboxEvent](evts,
+		func(idx int, src dao.OutboxEvent) domain.OutboxEvent {
+			return domain.OutboxEvent{
+				Id:      src.Id,
+				Topic:   src.Topic,
+				Payload: src.Payload,
+				Retries: src.Retries,
+				Ctime:   time.UnixMilli(src.Ctime),
+			}
+		}), nil
+}
+
+// MarkSent 标记为已经发送
+func (r *GORMOutboxRepository) MarkSent(ctx context.Context, ids []int64) error {
+	return r.dao.MarkSent(ctx, ids)
+}
+
+// MarkFailed 标记为发送失败,不会再发送
+func (r *GORMOutboxRepository) MarkFailed(ctx context.Context, id int64) error {
+	return r.dao.MarkFailed(ctx, id)
+}
+
+// IncrRetries 记录一次发送失败
+func (r *GORMOutboxRepository) IncrRetries(ctx context.Context, id int64) error {
+	return r.dao.IncrRetries(ctx, id)
+}
+
+// DeleteSentBefore 删除 t 之前已经发送的事件
+func (r *GORMOutboxRepository) DeleteSentBefore(ctx context.Context, t time.Time, limit int) (int64, error) {
+	return r.dao.DeleteSentBefore(ctx, t, limit)
+}
@@ -2,13 +2,17 @@ package service
 
 import (
 	"context"
+	"errors"
 	"github.com/ClearloveHn/golangwebook/webook/internal/domain"
 	"github.com/ClearloveHn/golangwebook/webook/internal/events/article"
 	"github.com/ClearloveHn/golangwebook/webook/internal/repository"
-	"gorm.io/gorm/logger"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
 	"time"
 )
 
+// ErrArticleNotFound 文章不存在,或者已经撤回了
+var ErrArticleNotFound = repository.ErrArticleNotFound
+
 //go:generate mockgen -source=./article.go -package=svcmocks -destination=./mocks/article.mock.go ArticleService
 type ArticleService interface {
 	Save(ctx context.Context, art domain.Article) (int64, error)
@@ -16,21 +20,25 @@ type ArticleService interface {
 	Withdraw(ctx context.Context, uid int64, id int64) error
 	GetByAuthor(ctx context.Context, uid int64, offset int, limit int) ([]domain.Article, error)
 	GetById(ctx context.Context, id int64) (domain.Article, error)
-	GetPubById(ctx context.Context, id, uid int64) (domain.Article, error)
+	// GetPubById uid 为 0 的是匿名读者,visitor 是匿名读者的标识
+	// 文章不存在或者已经撤回的返回 ErrArticleNotFound
+	GetPubById(ctx context.Context, id, uid int64, visitor string) (domain.Article, error)
 	ListPub(ctx context.Context, start time.Time, offset, limit int) ([]domain.Article, error)
 }
 
 type articleService struct {
 	repo     repository.ArticleRepository
-	producer article.Producer
+	outbox   OutboxService
 	userRepo repository.UserRepository
+	l        logger.LoggerV1
 }
 
 func NewArticleService(repo repository.ArticleRepository,
-	producer article.Producer) ArticleService {
+	outbox OutboxService, l logger.LoggerV1) ArticleService {
 	return &articleService{
-		repo:     repo,
-		producer: producer,
+		repo:   repo,
+		outbox: outbox,
+		l:      l,
 	}
 }
 
@@ -44,15 +52,66 @@ func (a *articleService) Save(ctx context.Context, art domain.Article) (int64, e
 	return a.repo.Create(ctx, art) // 创建新文章
 }
 
-// Publish 方法发布文章
+// Publish 方法发布文章，并发送发表或者修改事件
 func (a *articleService) Publish(ctx context.Context, art domain.Article) (int64, error) {
+	now := time.Now()
+	typ := article.ArticleEventPublished
+	art.Ctime = now
+	if art.Id > 0 {
+		// 草稿在 Save 的时候已经被改成未发表了,所以要看线上库
+		// 线上库里面有的就是修改,撤回之后再发表的依旧算发表
+		old, err := a.repo.GetPubById(ctx, art.Id)
+		if err == nil {
+			art.Ctime = old.Ctime
+			if old.Status != domain.ArticleStatusPrivate {
+				typ = article.ArticleEventUpdated
+			}
+		}
+	}
+
 	art.Status = domain.ArticleStatusPublished // 设置文章状态为已发布
-	return a.repo.Sync(ctx, art)               // 同步文章到仓库
+	id, err := a.repo.Sync(ctx, art)           // 同步文章到仓库
+	if err != nil {
+		return id, err
+	}
+
+	art.Id = id
+	art.Utime = now
+	// 文章已经发表了,但是下游收不到事件,返回错误让调用者重试,重试的时候会作为修改事件再记录一次
+	return id, a.addArticleEvent(ctx, typ, art)
 }
 
-// Withdraw 方法撤回文章
+// Withdraw 方法撤回文章，并发送撤回事件
 func (a *articleService) Withdraw(ctx context.Context, uid int64, id int64) error {
-	return a.repo.SyncStatus(ctx, uid, id, domain.ArticleStatusPrivate) // 同步文章状态为私有
+	err := a.repo.SyncStatus(ctx, uid, id, domain.ArticleStatusPrivate) // 同步文章状态为私有
+	if err != nil {
+		return err
+	}
+
+	art, err := a.repo.GetById(ctx, id)
+	if err != nil {
+		// 拿不到标题之类的信息,下游依旧需要知道文章被撤回了
+		a.l.Warn("撤回之后查询文章失败",
+			logger.Int64("aid", id),
+			logger.Error(err))
+		art = domain.Article{Id: id, Author: domain.Author{Id: uid}}
+	}
+	art.Utime = time.Now()
+	// 撤回是幂等的,失败了调用者重试就可以
+	return a.addArticleEvent(ctx, article.ArticleEventWithdrawn, art)
+}
+
+// addArticleEvent 写入文章生命周期事件
+// 文章本身已经写进去了,事件丢了下游就会一直不一致,所以失败的时候要返回错误
+func (a *articleService) addArticleEvent(ctx context.Context, typ article.ArticleEventType, art domain.Article) error {
+	err := a.outbox.AddArticleEvent(ctx, article.NewArticleEvent(typ, art))
+	if err != nil {
+		a.l.Error("记录文章事件失败",
+			logger.String("type", string(typ)),
+			logger.Int64("aid", art.Id),
+			logger.Error(err))
+	}
+	return err
 }
 
 // GetByAuthor 方法根据作者获取文章
@@ -65,26 +124,37 @@ func (a *articleService) GetById(ctx context.Context, id int64) (domain.Article,
 	return a.repo.GetById(ctx, id)
 }
 
-// GetPubById 方法根据文章 ID 获取已发布的文章，并异步发送阅读事件
-func (a *articleService) GetPubById(ctx context.Context, id, uid int64) (domain.Article, error) {
+// GetPubById 方法根据文章 ID 获取已发布的文章，并记录一个阅读事件
+// 阅读事件先写入 outbox,由后台任务发送,消息队列暂时不可用也不会丢
+// 线上库里面撤回的文章依旧在,只是状态变了,所以要检查状态,看不到的文章不记录阅读事件
+func (a *articleService) GetPubById(ctx context.Context, id, uid int64, visitor string) (domain.Article, error) {
 	res, err := a.repo.GetPubById(ctx, id)
-	go func() {
-		if err == nil {
-			// 在这里发送一个阅读事件
-			er := a.producer.ProduceReadEvent(article.ReadEvent{
-				Aid: id,
-				Uid: uid,
-			})
-			if er != nil {
-				a.l.Error("发送 ReadEvent 失败",
-					logger.Int64("aid", id),
-					logger.Int64("uid", uid),
-					logger.Error(err))
-			}
-		}
-	}()
+	if errors.Is(err, repository.ErrArticleNotFound) {
+		return domain.Article{}, ErrArticleNotFound
+	}
+	if err != nil {
+		return domain.Article{}, err
+	}
+	if res.Status != domain.ArticleStatusPublished {
+		return domain.Article{}, ErrArticleNotFound
+	}
 
-	return res, err
+	evt := article.ReadEvent{
+		Aid: id,
+		Uid: uid,
+	}
+	if uid == 0 {
+		evt.Visitor = visitor
+	}
+	er := a.outbox.AddReadEvent(ctx, evt)
+	if er != nil {
+		// 记录阅读事件失败不影响读者看文章
+		a.l.Error("记录 ReadEvent 失败",
+			logger.Int64("aid", id),
+			logger.Int64("uid", uid),
+			logger.Error(er))
+	}
+	return res, nil
 }
 
 // ListPub 方法获取指定时间之后的已发布文章列表
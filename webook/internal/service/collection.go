@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"github.com/ClearloveHn/golangwebook/webook/internal/domain"
+	"github.com/ClearloveHn/golangwebook/webook/internal/repository"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
+)
+
+var (
+	// ErrCollectionNotFound 收藏夹不存在,或者没有权限
+	ErrCollectionNotFound = repository.ErrCollectionNotFound
+	// ErrCollectionItemNotFound 没有收藏过
+	ErrCollectionItemNotFound = repository.ErrCollectionItemNotFound
+)
+
+// CollectionService 收藏夹
+// cid 为 0 的是默认收藏夹,不需要创建,只有自己能看到
+type CollectionService interface {
+	Create(ctx context.Context, c domain.Collection) (int64, error)
+	Update(ctx context.Context, c domain.Collection) error
+	Delete(ctx context.Context, uid int64, id int64) error
+	// List viewer 查看 owner 的收藏夹,不是自己的只能看到公开的
+	List(ctx context.Context, owner int64, viewer int64, offset int, limit int) ([]domain.Collection, error)
+	// Items viewer 查看收藏夹里面的收藏,文章会带上标题和摘要
+	Items(ctx context.Context, cid int64, viewer int64, offset int, limit int) ([]domain.CollectionItem, error)
+	// Move 把收藏移动到另外一个收藏夹
+	Move(ctx context.Context, uid int64, biz string, bizId int64, cid int64) error
+}
+
+type collectionService struct {
+	repo    repository.CollectionRepository
+	artRepo repository.ArticleRepository
+	l       logger.LoggerV1
+}
+
+func NewCollectionService(repo repository.CollectionRepository,
+	artRepo repository.ArticleRepository, l logger.LoggerV1) CollectionService {
+	return &collectionService{repo: repo, artRepo: artRepo, l: l}
+}
+
+func (s *collectionService) Create(ctx context.Context, c domain.Collection) (int64, error) {
+	if c.Visibility != domain.CollectionVisibilityPublic {
+		c.Visibility = domain.CollectionVisibilityPrivate
+	}
+	return s.repo.Create(ctx, c)
+}
+
+func (s *collectionService) Update(ctx context.Context, c domain.Collection) error {
+	if c.Visibility != domain.CollectionVisibilityPublic {
+		c.Visibility = domain.CollectionVisibilityPrivate
+	}
+	return s.repo.Update(ctx, c)
+}
+
+func (s *collectionService) Delete(ctx context.Context, uid int64, id int64) error {
+	return s.repo.Delete(ctx, uid, id)
+}
+
+func (s *collectionService) List(ctx context.Context, owner int64, viewer int64,
+	offset int, limit int) ([]domain.Collection, error) {
+	return s.repo.FindByUid(ctx, owner, owner != viewer, offset, limit)
+}
+
+func (s *collectionService) Items(ctx context.Context, cid int64, viewer int64,
+	offset int, limit int) ([]domain.CollectionItem, error) {
+	owner := viewer
+	if cid > 0 {
+		c, err := s.repo.FindById(ctx, cid)
+		if err != nil {
+			return nil, err
+		}
+		// 看不到的私密收藏夹和不存在一样处理,避免泄露收藏夹是否存在
+		if !c.VisibleTo(viewer) {
+			return nil, ErrCollectionNotFound
+		}
+		owner = c.Uid
+	}
+
+	items, err := s.repo.ListItems(ctx, owner, cid, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	return s.fillArticles(ctx, items), nil
+}
+
+// fillArticles 补全文章的标题和摘要,失败了只打印日志
+func (s *collectionService) fillArticles(ctx context.Context,
+	items []domain.CollectionItem) []domain.CollectionItem {
+	aids := make([]int64, 0, len(items))
+	for _, item := range items {
+		if item.Biz == "article" {
+			aids = append(aids, item.BizId)
+		}
+	}
+	if len(aids) == 0 {
+		return items
+	}
+	arts, err := s.artRepo.GetPubByIds(ctx, aids)
+	if err != nil {
+		s.l.Error("查询收藏对应的文章失败", logger.Error(err))
+		return items
+	}
+	artMap := make(map[int64]domain.Article, len(arts))
+	for _, art := range arts {
+		artMap[art.Id] = art
+	}
+	for i, item := range items {
+		if art, ok := artMap[item.BizId]; ok && item.Biz == "article" {
+			items[i].Title = art.Title
+			items[i].Abstract = art.Abstract()
+		}
+	}
+	return items
+}
+
+func (s *collectionService) Move(ctx context.Context, uid int64,
+	biz string, bizId int64, cid int64) error {
+	return s.repo.MoveItem(ctx, uid, biz, bizId, cid)
+}
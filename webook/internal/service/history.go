@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"github.com/ClearloveHn/golangwebook/webook/internal/domain"
+	"github.com/ClearloveHn/golangwebook/webook/internal/repository"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
+)
+
+// HistoryService 我的浏览记录
+type HistoryService interface {
+	// List 查询浏览记录,文章的记录会带上标题和摘要
+	List(ctx context.Context, uid int64, cursor domain.HistoryCursor, limit int) ([]domain.HistoryRecord, error)
+	Delete(ctx context.Context, uid int64, id int64) error
+	Clear(ctx context.Context, uid int64) error
+	// ReportProgress 保存客户端上报的阅读进度,文章不存在或者已经撤回的返回 ErrArticleNotFound
+	ReportProgress(ctx context.Context, p domain.ReadProgress) error
+	// ContinueReading 开始读了但是没有读完的文章,最近读的在前面
+	ContinueReading(ctx context.Context, uid int64, limit int) ([]domain.HistoryRecord, error)
+	// CompletionRates 文章的平均完成率,0 到 100,可以作为热榜的一个因子
+	CompletionRates(ctx context.Context, biz string, bizIds []int64) (map[int64]float64, error)
+}
+
+type historyService struct {
+	repo    repository.HistoryRecordRepository
+	artRepo repository.ArticleRepository
+	l       logger.LoggerV1
+}
+
+func NewHistoryService(repo repository.HistoryRecordRepository,
+	artRepo repository.ArticleRepository, l logger.LoggerV1) HistoryService {
+	return &historyService{repo: repo, artRepo: artRepo, l: l}
+}
+
+func (s *historyService) List(ctx context.Context, uid int64,
+	cursor domain.HistoryCursor, limit int) ([]domain.HistoryRecord, error) {
+	records, err := s.repo.List(ctx, uid, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	return s.fillArticles(ctx, uid, records), nil
+}
+
+// fillArticles 补全文章的标题和摘要,失败了只打印日志
+func (s *historyService) fillArticles(ctx context.Context, uid int64,
+	records []domain.HistoryRecord) []domain.HistoryRecord {
+	aids := make([]int64, 0, len(records))
+	for _, r := range records {
+		if r.Biz == "article" {
+			aids = append(aids, r.BizId)
+		}
+	}
+	if len(aids) == 0 {
+		return records
+	}
+	arts, err := s.artRepo.GetPubByIds(ctx, aids)
+	if err != nil {
+		// 补全不了标题也要让用户看到浏览记录
+		s.l.Error("查询浏览记录对应的文章失败",
+			logger.Int64("uid", uid),
+			logger.Error(err))
+		return records
+	}
+	artMap := make(map[int64]domain.Article, len(arts))
+	for _, art := range arts {
+		artMap[art.Id] = art
+	}
+	for i, r := range records {
+		if r.Biz != "article" {
+			continue
+		}
+		// 文章被删掉了之后就没有标题了,前端自己处理
+		if art, ok := artMap[r.BizId]; ok {
+			records[i].Title = art.Title
+			records[i].Abstract = art.Abstract()
+		}
+	}
+	return records
+}
+
+// ReportProgress 只接受已发表的文章,不然随便一个 id 都能生成浏览记录和进度统计
+func (s *historyService) ReportProgress(ctx context.Context, p domain.ReadProgress) error {
+	if p.Biz == "article" {
+		art, err := s.artRepo.GetPubById(ctx, p.BizId)
+		if err != nil {
+			return err
+		}
+		if art.Status != domain.ArticleStatusPublished {
+			return ErrArticleNotFound
+		}
+	}
+	return s.repo.UpdateProgress(ctx, p)
+}
+
+func (s *historyService) ContinueReading(ctx context.Context, uid int64, limit int) ([]domain.HistoryRecord, error) {
+	records, err := s.repo.ListUnfinished(ctx, uid, limit)
+	if err != nil {
+		return nil, err
+	}
+	return s.fillArticles(ctx, uid, records), nil
+}
+
+func (s *historyService) CompletionRates(ctx context.Context,
+	biz string, bizIds []int64) (map[int64]float64, error) {
+	return s.repo.CompletionRates(ctx, biz, bizIds)
+}
+
+func (s *historyService) Delete(ctx context.Context, uid int64, id int64) error {
+	return s.repo.Delete(ctx, uid, id)
+}
+
+func (s *historyService) Clear(ctx context.Context, uid int64) error {
+	return s.repo.Clear(ctx, uid)
+}
@@ -2,27 +2,58 @@ package service
 
 import (
 	"context"
+	"errors"
 	"github.com/ClearloveHn/golangwebook/webook/internal/domain"
 	"github.com/ClearloveHn/golangwebook/webook/internal/repository"
 	"golang.org/x/sync/errgroup"
 )
 
+var ErrInvalidReaction = errors.New("不支持的表态")
+
+// ReactionConfig 每个业务允许的表态
+type ReactionConfig struct {
+	// Reactions key 是 biz,value 是允许的表态,点赞是内置的,不需要配置
+	Reactions map[string][]string `yaml:"reactions"`
+}
+
+// allowed 判断某个业务是否允许这种表态
+func (cfg ReactionConfig) allowed(biz string, reaction string) bool {
+	if reaction == domain.ReactionLike {
+		return true
+	}
+	for _, r := range cfg.Reactions[biz] {
+		if r == reaction {
+			return true
+		}
+	}
+	return false
+}
+
 //go:generate mockgen -source=./interactive.go -package=svcmocks -destination=./mocks/interactive.mock.go InteractiveService
 type InteractiveService interface {
 	IncrReadCnt(ctx context.Context, biz string, bizId int64) error
 	Like(c context.Context, biz string, id int64, uid int64) error
 	CancelLike(c context.Context, biz string, id int64, uid int64) error
 	Collect(ctx context.Context, biz string, bizId, cid, uid int64) error
+	CancelCollect(ctx context.Context, biz string, bizId, uid int64) error
+	// React 和 CancelReaction 表态和取消表态,reaction 是 like 的时候等同于点赞
+	// 不支持的表态返回 ErrInvalidReaction
+	React(ctx context.Context, biz string, id int64, uid int64, reaction string) error
+	CancelReaction(ctx context.Context, biz string, id int64, uid int64, reaction string) error
 	Get(ctx context.Context, biz string, id int64, uid int64) (domain.Interactive, error)
 	GetByIds(ctx context.Context, biz string, ids []int64) (map[int64]domain.Interactive, error)
+	// FlushCounters 把暂存的计数写回数据库,由 job.InteractiveFlushJob 定期调用
+	FlushCounters(ctx context.Context) (int, error)
 }
 
 type interactiveService struct {
 	repo repository.InteractiveRepository
+	cfg  ReactionConfig
 }
 
-func NewInteractiveService(repo repository.InteractiveRepository) InteractiveService {
-	return &interactiveService{repo: repo}
+func NewInteractiveService(repo repository.InteractiveRepository,
+	cfg ReactionConfig) InteractiveService {
+	return &interactiveService{repo: repo, cfg: cfg}
 }
 
 // IncrReadCnt 方法增加业务实体的阅读次数
@@ -45,6 +76,33 @@ func (i *interactiveService) Collect(ctx context.Context, biz string, bizId, cid
 	return i.repo.AddCollectionItem(ctx, biz, bizId, cid, uid)
 }
 
+// CancelCollect 方法取消对业务实体的收藏
+func (i *interactiveService) CancelCollect(ctx context.Context, biz string, bizId, uid int64) error {
+	return i.repo.DeleteCollectionItem(ctx, biz, bizId, uid)
+}
+
+// React 方法对业务实体进行表态
+func (i *interactiveService) React(ctx context.Context, biz string, id int64, uid int64, reaction string) error {
+	if !i.cfg.allowed(biz, reaction) {
+		return ErrInvalidReaction
+	}
+	if reaction == domain.ReactionLike {
+		return i.repo.IncrLike(ctx, biz, id, uid)
+	}
+	return i.repo.IncrReaction(ctx, biz, id, uid, reaction)
+}
+
+// CancelReaction 方法取消对业务实体的表态
+func (i *interactiveService) CancelReaction(ctx context.Context, biz string, id int64, uid int64, reaction string) error {
+	if !i.cfg.allowed(biz, reaction) {
+		return ErrInvalidReaction
+	}
+	if reaction == domain.ReactionLike {
+		return i.repo.DecrLike(ctx, biz, id, uid)
+	}
+	return i.repo.DecrReaction(ctx, biz, id, uid, reaction)
+}
+
 // Get 方法获取业务实体的交互信息
 func (i *interactiveService) Get(ctx context.Context, biz string, id int64, uid int64) (domain.Interactive, error) {
 	intr, err := i.repo.Get(ctx, biz, id)
@@ -52,8 +110,11 @@ func (i *interactiveService) Get(ctx context.Context, biz string, id int64, uid
 		return domain.Interactive{}, err
 	}
 
-	// 并发获取业务实体是否被当前用户点赞和收藏。
-	var eg errgroup.Group
+	// 并发获取业务实体是否被当前用户点赞、收藏和表态。
+	var (
+		eg          errgroup.Group
+		myReactions []string
+	)
 	eg.Go(func() error {
 		var er error
 		intr.Liked, er = i.repo.Liked(ctx, biz, id, uid)
@@ -66,7 +127,39 @@ func (i *interactiveService) Get(ctx context.Context, biz string, id int64, uid
 		return er
 	})
 
-	return intr, eg.Wait()
+	eg.Go(func() error {
+		var er error
+		myReactions, er = i.repo.Reactions(ctx, biz, id, uid)
+		return er
+	})
+
+	err = eg.Wait()
+	if err != nil {
+		return domain.Interactive{}, err
+	}
+	i.fillReactions(biz, &intr, myReactions)
+	return intr, nil
+}
+
+// fillReactions 把点赞合并到表态里面,并且去掉配置里面已经不允许的表态
+func (i *interactiveService) fillReactions(biz string, intr *domain.Interactive, mine []string) {
+	reactions := map[string]int64{domain.ReactionLike: intr.LikeCnt}
+	for _, r := range i.cfg.Reactions[biz] {
+		if r != domain.ReactionLike {
+			reactions[r] = intr.Reactions[r]
+		}
+	}
+	intr.Reactions = reactions
+
+	intr.MyReactions = make([]string, 0, len(mine)+1)
+	if intr.Liked {
+		intr.MyReactions = append(intr.MyReactions, domain.ReactionLike)
+	}
+	for _, r := range mine {
+		if i.cfg.allowed(biz, r) {
+			intr.MyReactions = append(intr.MyReactions, r)
+		}
+	}
 }
 
 // GetByIds 方法批量获取多个业务实体的交互信息
@@ -82,3 +175,8 @@ func (i *interactiveService) GetByIds(ctx context.Context,
 	}
 	return res, nil
 }
+
+// FlushCounters 方法把暂存的计数增量写回数据库
+func (i *interactiveService) FlushCounters(ctx context.Context) (int, error) {
+	return i.repo.FlushCounters(ctx)
+}
@@ -4,7 +4,7 @@ import (
 	"context"
 	"github.com/ClearloveHn/golangwebook/webook/internal/domain"
 	"github.com/ClearloveHn/golangwebook/webook/internal/repository"
-	"gorm.io/gorm/logger"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
 	"time"
 )
 
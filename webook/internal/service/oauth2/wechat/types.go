@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/ClearloveHn/golangwebook/webook/internal/domain"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
 	"net/http"
 	"net/url"
 )
@@ -18,22 +19,29 @@ type Service interface {
 	VerifyCode(ctx context.Context, code string) (domain.WechatInfo, error)
 }
 
-// redirectURL 是微信登录回调的URL，需要进行URL编码
-var redirectURL = url.PathEscape("https://meoying.com/oauth2/wechat/callback")
+// DefaultRedirectURL 是默认的微信登录回调的URL
+const DefaultRedirectURL = "https://meoying.com/oauth2/wechat/callback"
 
 // service 结构体实现了 Service 接口
 type service struct {
-	appID     string          // 微信应用的 App ID
-	appSecret string          // 微信应用的 App Secret
-	client    *http.Client    // HTTP 客户端，用于发送请求
-	l         logger.LoggerV1 // 日志记录器
+	appID       string          // 微信应用的 App ID
+	appSecret   string          // 微信应用的 App Secret
+	redirectURL string          // 微信登录回调的URL，已经进行了URL编码
+	client      *http.Client    // HTTP 客户端，用于发送请求
+	l           logger.LoggerV1 // 日志记录器
 }
 
-func NewService(appID string, appSecret string, l logger.LoggerV1) Service {
+// NewService 创建微信登录服务，redirectURL 为空的时候使用 DefaultRedirectURL
+func NewService(appID string, appSecret string, redirectURL string, l logger.LoggerV1) Service {
+	if redirectURL == "" {
+		redirectURL = DefaultRedirectURL
+	}
 	return &service{
-		appID:     appID,
-		appSecret: appSecret,
-		client:    http.DefaultClient,
+		appID:       appID,
+		appSecret:   appSecret,
+		redirectURL: url.PathEscape(redirectURL),
+		client:      http.DefaultClient,
+		l:           l,
 	}
 }
 
@@ -42,7 +50,7 @@ func (s *service) AuthURL(ctx context.Context, state string) (string, error) {
 	// 微信登录授权URL的模板
 	const authURLPattern = `https://open.weixin.qq.com/connect/qrconnect?appid=%s&redirect_uri=%s&response_type=code&scope=snsapi_login&state=%s#wechat_redirect`
 	// 使用 fmt.Sprintf 函数将参数填充到模板中，生成最终的URL
-	return fmt.Sprintf(authURLPattern, s.appID, redirectURL, state), nil
+	return fmt.Sprintf(authURLPattern, s.appID, s.redirectURL, state), nil
 }
 
 // VerifyCode 方法验证微信返回的授权码，并获取用户信息
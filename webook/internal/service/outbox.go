@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ClearloveHn/golangwebook/webook/internal/domain"
+	"github.com/ClearloveHn/golangwebook/webook/internal/events/article"
+	userevents "github.com/ClearloveHn/golangwebook/webook/internal/events/user"
+	"github.com/ClearloveHn/golangwebook/webook/internal/repository"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
+	"github.com/bwmarrin/snowflake"
+	"time"
+)
+
+// errBadOutboxEvent 事件本身有问题,重试也没有用
+var errBadOutboxEvent = errors.New("无法发送的 outbox 事件")
+
+// OutboxService 事件先写入 outbox 表,再由后台任务通过对应的 producer 发送
+type OutboxService interface {
+	// AddReadEvent 写入一个阅读事件,由 Relay 发送
+	AddReadEvent(ctx context.Context, evt article.ReadEvent) error
+	// AddArticleEvent 写入一个文章生命周期事件,由 Relay 发送
+	AddArticleEvent(ctx context.Context, evt article.ArticleEvent) error
+	// AddUserCreatedEvent 和 AddUserProfileUpdatedEvent 写入用户的生命周期事件,由 Relay 发送
+	AddUserCreatedEvent(ctx context.Context, evt userevents.UserCreatedEvent) error
+	AddUserProfileUpdatedEvent(ctx context.Context, evt userevents.UserProfileUpdatedEvent) error
+	// Relay 发送一批待发送的事件,返回发送成功的条数
+	// 有待发送的事件但是一条都没有发送成功的时候返回错误
+	Relay(ctx context.Context) (int, error)
+	// Cleanup 清理超过保留时间的已发送事件,返回删除的条数
+	Cleanup(ctx context.Context) (int64, error)
+}
+
+type outboxService struct {
+	repo        repository.OutboxRepository
+	producer    article.Producer
+	artProducer article.ArticleEventProducer
+	usrProducer userevents.Producer
+	node        *snowflake.Node // 生成阅读事件的 ID
+	l           logger.LoggerV1
+	batchSize   int
+	retention   time.Duration
+}
+
+// NewOutboxService 所有的 producer 都必须是同步的,返回 nil 的时候 kafka 已经确认收到,
+// 例如 article.SaramaSyncProducer。Relay 发送之后立刻 MarkSent,
+// 用 SaramaBatchProducer 这种异步的 producer 会在发送失败的时候丢事件。
+func NewOutboxService(repo repository.OutboxRepository,
+	producer article.Producer, artProducer article.ArticleEventProducer,
+	usrProducer userevents.Producer,
+	node *snowflake.Node, l logger.LoggerV1) OutboxService {
+	return &outboxService{
+		repo:        repo,
+		producer:    producer,
+		artProducer: artProducer,
+		usrProducer: usrProducer,
+		node:        node,
+		l:           l,
+		batchSize:   100,
+		retention:   time.Hour * 24 * 7,
+	}
+}
+
+// AddReadEvent 写入 outbox 之前生成事件 ID,Relay 重复发送的时候 ID 不变,消费者才能去重
+func (s *outboxService) AddReadEvent(ctx context.Context, evt article.ReadEvent) error {
+	if evt.Id == 0 {
+		evt.Id = s.node.Generate().Int64()
+	}
+	return s.add(ctx, article.TopicReadEvent, evt)
+}
+
+func (s *outboxService) AddArticleEvent(ctx context.Context, evt article.ArticleEvent) error {
+	return s.add(ctx, article.TopicArticleEvent, evt)
+}
+
+func (s *outboxService) AddUserCreatedEvent(ctx context.Context, evt userevents.UserCreatedEvent) error {
+	return s.add(ctx, userevents.TopicUserCreated, evt)
+}
+
+func (s *outboxService) AddUserProfileUpdatedEvent(ctx context.Context, evt userevents.UserProfileUpdatedEvent) error {
+	return s.add(ctx, userevents.TopicUserProfileUpdated, evt)
+}
+
+func (s *outboxService) add(ctx context.Context, topic string, evt any) error {
+	payload, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	return s.repo.Add(ctx, domain.OutboxEvent{
+		Topic:   topic,
+		Payload: payload,
+	})
+}
+
+// Relay 按照写入的顺序发送事件
+// 事件本身有问题的标记为失败,跳过;
+// 发送失败的说明消息队列可能不可用,这一轮直接结束,下一轮再从这条开始发送
+func (s *outboxService) Relay(ctx context.Context) (int, error) {
+	evts, err := s.repo.FindPending(ctx, s.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := make([]int64, 0, len(evts))
+	var relayErr error
+	for _, evt := range evts {
+		err = s.publish(evt)
+		if errors.Is(err, errBadOutboxEvent) {
+			s.l.Error("outbox 事件无法发送",
+				logger.Int64("id", evt.Id),
+				logger.String("topic", evt.Topic),
+				logger.Error(err))
+			if er := s.repo.MarkFailed(ctx, evt.Id); er != nil {
+				// 标记不了的话这条事件会一直卡在最前面,这一轮直接结束
+				relayErr = fmt.Errorf("标记 outbox 事件 %d 失败 %w", evt.Id, er)
+				break
+			}
+			continue
+		}
+		if err != nil {
+			relayErr = err
+			if er := s.repo.IncrRetries(ctx, evt.Id); er != nil {
+				s.l.Error("记录 outbox 事件重试次数失败",
+					logger.Int64("id", evt.Id),
+					logger.Error(er))
+			}
+			break
+		}
+		sent = append(sent, evt.Id)
+	}
+
+	// 先把发送成功的标记了,避免重复发送
+	err = s.repo.MarkSent(ctx, sent)
+	if err != nil {
+		return 0, err
+	}
+	if relayErr == nil && len(evts) > 0 && len(sent) == 0 {
+		// 一整批都发送不了,返回错误让调用者知道,不要当成已经没有待发送的事件
+		relayErr = fmt.Errorf("%w 这一批 %d 条事件都无法发送", errBadOutboxEvent, len(evts))
+	}
+	return len(sent), relayErr
+}
+
+// publish 根据 topic 反序列化并通过 producer 发送
+func (s *outboxService) publish(evt domain.OutboxEvent) error {
+	switch evt.Topic {
+	case article.TopicReadEvent:
+		var re article.ReadEvent
+		if err := json.Unmarshal(evt.Payload, &re); err != nil {
+			return fmt.Errorf("%w %w", errBadOutboxEvent, err)
+		}
+		return s.producer.ProduceReadEvent(re)
+	case article.TopicArticleEvent:
+		var ae article.ArticleEvent
+		if err := json.Unmarshal(evt.Payload, &ae); err != nil {
+			return fmt.Errorf("%w %w", errBadOutboxEvent, err)
+		}
+		return s.artProducer.ProduceArticleEvent(ae)
+	case userevents.TopicUserCreated:
+		var ue userevents.UserCreatedEvent
+		if err := json.Unmarshal(evt.Payload, &ue); err != nil {
+			return fmt.Errorf("%w %w", errBadOutboxEvent, err)
+		}
+		return s.usrProducer.ProduceUserCreated(ue)
+	case userevents.TopicUserProfileUpdated:
+		var ue userevents.UserProfileUpdatedEvent
+		if err := json.Unmarshal(evt.Payload, &ue); err != nil {
+			return fmt.Errorf("%w %w", errBadOutboxEvent, err)
+		}
+		return s.usrProducer.ProduceUserProfileUpdated(ue)
+	default:
+		return fmt.Errorf("%w 未知的 topic %s", errBadOutboxEvent, evt.Topic)
+	}
+}
+
+// Cleanup 分批删除,避免一次删除太多数据锁表
+func (s *outboxService) Cleanup(ctx context.Context) (int64, error) {
+	before := time.Now().Add(-s.retention)
+	var total int64
+	for {
+		cnt, err := s.repo.DeleteSentBefore(ctx, before, s.batchSize)
+		total += cnt
+		if err != nil || cnt < int64(s.batchSize) {
+			return total, err
+		}
+	}
+}
@@ -2,17 +2,23 @@ package localsms
 
 import (
 	"context"
-	"log"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
 )
 
+// Service 本地开发用的短信服务,不真的发短信,只是把内容打印出来
+// 想在本地看到验证码的话,把脱敏规则里面的 code 规则关掉
 type Service struct {
+	l logger.LoggerV1
 }
 
-func NewService() *Service {
-	return &Service{}
+func NewService(l logger.LoggerV1) *Service {
+	return &Service{l: l}
 }
 
 func (s *Service) Send(ctx context.Context, tplId string, args []string, numbers ...string) error {
-	log.Println("验证码是", args)
+	s.l.Info("发送短信",
+		logger.String("tplId", tplId),
+		logger.Any("tplParams", args),
+		logger.Any("phones", numbers))
 	return nil
 }
@@ -3,10 +3,10 @@ package tencent
 import (
 	"context"
 	"fmt"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
 	"github.com/ecodeclub/ekit"
 	"github.com/ecodeclub/ekit/slice"
 	sms "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/sms/v20210111"
-	"go.uber.org/zap"
 )
 
 // Service 结构体表示腾讯云短信服务
@@ -14,13 +14,16 @@ type Service struct {
 	client   *sms.Client // 腾讯云短信客户端
 	appId    *string     // 短信应用 ID
 	signName *string     // 短信签名
+	// 日志里面有手机号和验证码,生产环境需要传入 logger.MaskLogger
+	l logger.LoggerV1
 }
 
-func NewService(client *sms.Client, appId string, signName string) *Service {
+func NewService(client *sms.Client, appId string, signName string, l logger.LoggerV1) *Service {
 	return &Service{
 		client:   client,
 		appId:    &appId,
 		signName: &signName,
+		l:        l,
 	}
 }
 
@@ -38,10 +41,17 @@ func (s *Service) Send(ctx context.Context, tplId string, args []string, numbers
 	// 发送短信请求
 	response, err := s.client.SendSms(request)
 
-	// 记录请求和响应的日志
-	zap.L().Debug("请求腾讯SendSMS接口",
-		zap.Any("req", request),
-		zap.Any("resp", response))
+	// 记录请求和响应的日志,手机号和模板参数(一般是验证码)用脱敏规则认识的字段名
+	var requestId string
+	if response != nil && response.Response != nil && response.Response.RequestId != nil {
+		requestId = *response.Response.RequestId
+	}
+	s.l.Debug("请求腾讯SendSMS接口",
+		logger.String("tplId", tplId),
+		logger.Any("tplParams", args),
+		logger.Any("phones", numbers),
+		logger.String("requestId", requestId),
+		logger.Error(err))
 
 	// 处理异常
 	if err != nil {
@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"github.com/ClearloveHn/golangwebook/webook/internal/domain"
+	userevents "github.com/ClearloveHn/golangwebook/webook/internal/events/user"
 	"github.com/ClearloveHn/golangwebook/webook/internal/repository"
-	"go.uber.org/zap"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
 	"golang.org/x/crypto/bcrypt"
+	"time"
 )
 
 var (
@@ -25,14 +27,18 @@ type UserService interface {
 }
 
 type userService struct {
-	repo repository.UserRepository
-	//logger *zap.Logger
+	repo   repository.UserRepository
+	outbox OutboxService
+	l      logger.LoggerV1
 }
 
-func NewUserService(repo repository.UserRepository) UserService {
+// NewUserService 用户事件和文章事件一样先写入 outbox,消息队列不可用的时候也不会丢
+func NewUserService(repo repository.UserRepository,
+	outbox OutboxService, l logger.LoggerV1) UserService {
 	return &userService{
-		repo: repo,
-		//logger: zap.L(),
+		repo:   repo,
+		outbox: outbox,
+		l:      l,
 	}
 }
 
@@ -42,7 +48,21 @@ func (svc *userService) Signup(ctx context.Context, u domain.User) error {
 		return err
 	}
 	u.Password = string(hash)
-	return svc.repo.Create(ctx, u)
+	err = svc.repo.Create(ctx, u)
+	if err != nil {
+		return err
+	}
+
+	// Create 拿不到 ID,查一下
+	nu, err := svc.repo.FindByEmail(ctx, u.Email)
+	if err != nil {
+		svc.l.Error("注册之后查询用户失败,无法发送注册事件",
+			logger.String("email", u.Email),
+			logger.Error(err))
+		return nil
+	}
+	svc.addUserCreatedEvent(ctx, nu, userevents.ChannelEmail)
+	return nil
 }
 
 func (svc *userService) Login(ctx context.Context, email string, password string) (domain.User, error) {
@@ -64,8 +84,46 @@ func (svc *userService) Login(ctx context.Context, email string, password string
 
 func (svc *userService) UpdateNonSensitiveInfo(ctx context.Context,
 	user domain.User) error {
+	old, err := svc.repo.FindById(ctx, user.Id)
+	if err != nil {
+		return err
+	}
+
+	// 只有真的变了的字段才放到事件里面,什么都没变就不用更新,也不发送事件
+	evt := userevents.UserProfileUpdatedEvent{
+		Uid:   user.Id,
+		Utime: time.Now().UnixMilli(),
+	}
+	changed := false
+	if user.Nickname != "" && user.Nickname != old.Nickname {
+		evt.Nickname = user.Nickname
+		changed = true
+	}
+	if user.AboutMe != "" && user.AboutMe != old.AboutMe {
+		evt.AboutMe = user.AboutMe
+		changed = true
+	}
+	if !user.Birthday.IsZero() && !user.Birthday.Equal(old.Birthday) {
+		evt.Birthday = user.Birthday.Format(time.DateOnly)
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+
 	// UpdateNicknameAndXXAnd
-	return svc.repo.UpdateNonZeroFields(ctx, user)
+	err = svc.repo.UpdateNonZeroFields(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	er := svc.outbox.AddUserProfileUpdatedEvent(ctx, evt)
+	if er != nil {
+		svc.l.Error("记录用户资料修改事件失败",
+			logger.Int64("uid", user.Id),
+			logger.Error(er))
+	}
+	return nil
 }
 
 func (svc *userService) FindById(ctx context.Context,
@@ -91,9 +149,14 @@ func (svc *userService) FindOrCreate(ctx context.Context, phone string) (domain.
 	if err != nil && !errors.Is(err, repository.ErrDuplicateUser) {
 		return domain.User{}, err
 	}
+	created := err == nil
 	// 要么 err ==nil，要么ErrDuplicateUser，也代表用户存在
 	// 主从延迟，理论上来讲，强制走主库
-	return svc.repo.FindByPhone(ctx, phone)
+	u, err = svc.repo.FindByPhone(ctx, phone)
+	if err == nil && created {
+		svc.addUserCreatedEvent(ctx, u, userevents.ChannelPhone)
+	}
+	return u, err
 }
 
 func (svc *userService) FindOrCreateByWechat(ctx context.Context, wechatInfo domain.WechatInfo) (domain.User, error) {
@@ -102,14 +165,38 @@ func (svc *userService) FindOrCreateByWechat(ctx context.Context, wechatInfo dom
 		return u, err
 	}
 	// 这边就是意味着是一个新用户
-	// JSON 格式的 wechatInfo
-	zap.L().Info("新用户", zap.Any("wechatInfo", wechatInfo))
-	//svc.logger.Info("新用户", zap.Any("wechatInfo", wechatInfo))
+	// openid 和 unionid 会被脱敏
+	svc.l.Info("新用户",
+		logger.String("openId", wechatInfo.OpenId),
+		logger.String("unionId", wechatInfo.UnionId))
 	err = svc.repo.Create(ctx, domain.User{
 		WechatInfo: wechatInfo,
 	})
 	if err != nil && !errors.Is(err, repository.ErrDuplicateUser) {
 		return domain.User{}, err
 	}
-	return svc.repo.FindByWechat(ctx, wechatInfo.OpenId)
+	// 唯一索引冲突说明别的请求已经创建了,事件由它发送
+	created := err == nil
+	u, err = svc.repo.FindByWechat(ctx, wechatInfo.OpenId)
+	if err == nil && created {
+		svc.addUserCreatedEvent(ctx, u, userevents.ChannelWechat)
+	}
+	return u, err
+}
+
+// addUserCreatedEvent 记录注册事件,由 outbox 发送,失败了不影响注册
+func (svc *userService) addUserCreatedEvent(ctx context.Context, u domain.User, channel userevents.Channel) {
+	err := svc.outbox.AddUserCreatedEvent(ctx, userevents.UserCreatedEvent{
+		Uid:     u.Id,
+		Channel: channel,
+		Email:   u.Email,
+		Phone:   u.Phone,
+		Ctime:   u.Ctime.UnixMilli(),
+	})
+	if err != nil {
+		svc.l.Error("记录用户注册事件失败",
+			logger.Int64("uid", u.Id),
+			logger.String("channel", string(channel)),
+			logger.Error(err))
+	}
 }
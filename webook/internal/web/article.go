@@ -0,0 +1,412 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/ClearloveHn/golangwebook/webook/internal/domain"
+	"github.com/ClearloveHn/golangwebook/webook/internal/errs"
+	"github.com/ClearloveHn/golangwebook/webook/internal/service"
+	ijwt "github.com/ClearloveHn/golangwebook/webook/internal/web/jwt"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
+	"github.com/ecodeclub/ekit/slice"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/errgroup"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var _ handler = &ArticleHandler{}
+
+// ArticleHandler 文章模块的 HTTP 处理器,包括创作者和读者两部分
+type ArticleHandler struct {
+	svc     service.ArticleService
+	intrSvc service.InteractiveService
+	biz     string
+	l       logger.LoggerV1
+}
+
+func NewArticleHandler(svc service.ArticleService,
+	intrSvc service.InteractiveService, l logger.LoggerV1) *ArticleHandler {
+	return &ArticleHandler{
+		svc:     svc,
+		intrSvc: intrSvc,
+		biz:     "article",
+		l:       l,
+	}
+}
+
+// RegisterRoutes 注册文章模块的路由
+func (h *ArticleHandler) RegisterRoutes(server *gin.Engine) {
+	g := server.Group("/articles")
+
+	// 创作者接口
+	g.POST("/edit", h.Edit)
+	g.POST("/publish", h.Publish)
+	g.POST("/withdraw", h.Withdraw)
+	g.POST("/list", h.List)
+	g.GET("/detail/:id", h.Detail)
+
+	// 读者接口
+	pub := g.Group("/pub")
+	pub.GET("/:id", h.PubDetail)
+	// 传入一个参数,true 就是点赞, false 就是取消点赞
+	pub.POST("/like", h.Like)
+	// 表态,点赞也是一种表态
+	pub.POST("/react", h.React)
+	pub.POST("/collect", h.Collect)
+	pub.POST("/uncollect", h.CancelCollect)
+}
+
+// Edit 保存草稿,新建的时候 id 为 0
+func (h *ArticleHandler) Edit(ctx *gin.Context) {
+	var req ArticleReq
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+
+	uc := ctx.MustGet("user").(ijwt.UserClaims)
+	id, err := h.svc.Save(ctx, req.toDomain(uc.Uid))
+	if err != nil {
+		h.l.Error("保存文章数据失败",
+			logger.Int64("uid", uc.Uid),
+			logger.Error(err))
+		ctx.JSON(http.StatusOK, Result{Code: errs.ArticleInternalServerError, Msg: "系统错误"})
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Data: id})
+}
+
+// Publish 发表文章
+func (h *ArticleHandler) Publish(ctx *gin.Context) {
+	var req ArticleReq
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+
+	uc := ctx.MustGet("user").(ijwt.UserClaims)
+	id, err := h.svc.Publish(ctx, req.toDomain(uc.Uid))
+	if err != nil {
+		h.l.Error("发表文章失败",
+			logger.Int64("uid", uc.Uid),
+			logger.Error(err))
+		ctx.JSON(http.StatusOK, Result{Code: errs.ArticleInternalServerError, Msg: "系统错误"})
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Data: id})
+}
+
+// Withdraw 撤回文章,撤回之后文章仅自己可见
+func (h *ArticleHandler) Withdraw(ctx *gin.Context) {
+	type Req struct {
+		Id int64 `json:"id"`
+	}
+
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+
+	uc := ctx.MustGet("user").(ijwt.UserClaims)
+	err := h.svc.Withdraw(ctx, uc.Uid, req.Id)
+	if err != nil {
+		h.l.Error("撤回文章失败",
+			logger.Int64("uid", uc.Uid),
+			logger.Int64("aid", req.Id),
+			logger.Error(err))
+		ctx.JSON(http.StatusOK, Result{Code: errs.ArticleInternalServerError, Msg: "系统错误"})
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "OK"})
+}
+
+// List 创作者查看自己的文章列表,列表里面只有摘要
+func (h *ArticleHandler) List(ctx *gin.Context) {
+	var page Page
+	if err := ctx.Bind(&page); err != nil {
+		return
+	}
+	if page.Limit <= 0 || page.Limit > 100 {
+		ctx.JSON(http.StatusOK, Result{Code: errs.ArticleInvalidInput, Msg: "分页参数不对"})
+		return
+	}
+
+	uc := ctx.MustGet("user").(ijwt.UserClaims)
+	arts, err := h.svc.GetByAuthor(ctx, uc.Uid, page.Offset, page.Limit)
+	if err != nil {
+		h.l.Error("查找文章列表失败",
+			logger.Int64("uid", uc.Uid),
+			logger.Int("offset", page.Offset),
+			logger.Int("limit", page.Limit),
+			logger.Error(err))
+		ctx.JSON(http.StatusOK, Result{Code: errs.ArticleInternalServerError, Msg: "系统错误"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, Result{
+		Data: slice.Map[domain.Article, ArticleVO](arts,
+			func(idx int, src domain.Article) ArticleVO {
+				return ArticleVO{
+					Id:       src.Id,
+					Title:    src.Title,
+					Abstract: src.Abstract(),
+					Status:   src.Status.ToUint8(),
+					Ctime:    src.Ctime.Format(time.DateTime),
+					Utime:    src.Utime.Format(time.DateTime),
+				}
+			}),
+	})
+}
+
+// Detail 创作者查看自己文章的详情
+func (h *ArticleHandler) Detail(ctx *gin.Context) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.ArticleInvalidInput, Msg: "id 参数错误"})
+		return
+	}
+
+	uc := ctx.MustGet("user").(ijwt.UserClaims)
+	art, err := h.svc.GetById(ctx, id)
+	if err != nil {
+		h.l.Error("查询文章失败",
+			logger.Int64("id", id),
+			logger.Error(err))
+		ctx.JSON(http.StatusOK, Result{Code: errs.ArticleInternalServerError, Msg: "系统错误"})
+		return
+	}
+
+	// 只能看自己的文章
+	if art.Author.Id != uc.Uid {
+		// 如果不是自己的文章,说明有人在搞鬼,不需要告诉前端具体原因
+		h.l.Warn("非法访问文章,创作者 ID 不匹配",
+			logger.Int64("uid", uc.Uid),
+			logger.Int64("aid", id))
+		ctx.JSON(http.StatusOK, Result{Code: errs.ArticleInvalidInput, Msg: "输入有误"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, Result{
+		Data: ArticleVO{
+			Id:      art.Id,
+			Title:   art.Title,
+			Content: art.Content,
+			Status:  art.Status.ToUint8(),
+			Ctime:   art.Ctime.Format(time.DateTime),
+			Utime:   art.Utime.Format(time.DateTime),
+		},
+	})
+}
+
+// PubDetail 读者查看已发表的文章,同时返回阅读、点赞、收藏数,以及自己是否点赞收藏过
+// 没有登录的读者 uid 为 0,阅读数按照 IP 和 User-Agent 去重
+// 这个路径需要加入到登录校验中间件的 OptionalPaths 里面,写成 /articles/pub/:id
+func (h *ArticleHandler) PubDetail(ctx *gin.Context) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.ArticleInvalidInput, Msg: "id 参数错误"})
+		return
+	}
+
+	var uc ijwt.UserClaims
+	if val, ok := ctx.Get("user"); ok {
+		uc = val.(ijwt.UserClaims)
+	}
+	var (
+		eg   errgroup.Group
+		art  domain.Article
+		intr domain.Interactive
+	)
+	eg.Go(func() error {
+		var er error
+		art, er = h.svc.GetPubById(ctx, id, uc.Uid, visitor(ctx))
+		return er
+	})
+	eg.Go(func() error {
+		var er error
+		intr, er = h.intrSvc.Get(ctx, h.biz, id, uc.Uid)
+		if er != nil {
+			// 拿不到阅读数之类的数据,不影响读者看文章,降级处理
+			h.l.Error("查询文章交互数据失败",
+				logger.Int64("aid", id),
+				logger.Int64("uid", uc.Uid),
+				logger.Error(er))
+		}
+		return nil
+	})
+
+	err = eg.Wait()
+	if errors.Is(err, service.ErrArticleNotFound) {
+		ctx.JSON(http.StatusOK, Result{Code: errs.ArticleNotFound, Msg: "文章不存在"})
+		return
+	}
+	if err != nil {
+		h.l.Error("查询文章失败,系统错误",
+			logger.Int64("aid", id),
+			logger.Int64("uid", uc.Uid),
+			logger.Error(err))
+		ctx.JSON(http.StatusOK, Result{Code: errs.ArticleInternalServerError, Msg: "系统错误"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, Result{
+		Data: ArticleVO{
+			Id:          art.Id,
+			Title:       art.Title,
+			Content:     art.Content,
+			AuthorId:    art.Author.Id,
+			AuthorName:  art.Author.Name,
+			Ctime:       art.Ctime.Format(time.DateTime),
+			Utime:       art.Utime.Format(time.DateTime),
+			ReadCnt:     intr.ReadCnt,
+			LikeCnt:     intr.LikeCnt,
+			CollectCnt:  intr.CollectCnt,
+			Liked:       intr.Liked,
+			Collected:   intr.Collected,
+			Reactions:   intr.Reactions,
+			MyReactions: intr.MyReactions,
+		},
+	})
+}
+
+// Like 点赞或者取消点赞
+func (h *ArticleHandler) Like(ctx *gin.Context) {
+	type Req struct {
+		Id int64 `json:"id"`
+		// true 是点赞,false 是取消点赞
+		Like bool `json:"like"`
+	}
+
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+
+	uc := ctx.MustGet("user").(ijwt.UserClaims)
+	var err error
+	if req.Like {
+		err = h.intrSvc.Like(ctx, h.biz, req.Id, uc.Uid)
+	} else {
+		err = h.intrSvc.CancelLike(ctx, h.biz, req.Id, uc.Uid)
+	}
+	if err != nil {
+		h.l.Error("点赞/取消点赞失败",
+			logger.Int64("uid", uc.Uid),
+			logger.Int64("aid", req.Id),
+			logger.Bool("like", req.Like),
+			logger.Error(err))
+		ctx.JSON(http.StatusOK, Result{Code: errs.ArticleInternalServerError, Msg: "系统错误"})
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "OK"})
+}
+
+// React 表态或者取消表态,重复表态不会重复计数
+func (h *ArticleHandler) React(ctx *gin.Context) {
+	type Req struct {
+		Id       int64  `json:"id"`
+		Reaction string `json:"reaction"`
+		// true 是表态,false 是取消表态
+		React bool `json:"react"`
+	}
+
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+
+	uc := ctx.MustGet("user").(ijwt.UserClaims)
+	var err error
+	if req.React {
+		err = h.intrSvc.React(ctx, h.biz, req.Id, uc.Uid, req.Reaction)
+	} else {
+		err = h.intrSvc.CancelReaction(ctx, h.biz, req.Id, uc.Uid, req.Reaction)
+	}
+	switch {
+	case err == nil:
+		ctx.JSON(http.StatusOK, Result{Msg: "OK"})
+	case errors.Is(err, service.ErrInvalidReaction):
+		ctx.JSON(http.StatusOK, Result{Code: errs.ArticleInvalidInput, Msg: "不支持的表态"})
+	default:
+		h.l.Error("表态/取消表态失败",
+			logger.Int64("uid", uc.Uid),
+			logger.Int64("aid", req.Id),
+			logger.String("reaction", req.Reaction),
+			logger.Bool("react", req.React),
+			logger.Error(err))
+		ctx.JSON(http.StatusOK, Result{Code: errs.ArticleInternalServerError, Msg: "系统错误"})
+	}
+}
+
+// Collect 收藏文章到某个收藏夹
+func (h *ArticleHandler) Collect(ctx *gin.Context) {
+	type Req struct {
+		Id int64 `json:"id"`
+		// 收藏夹的 ID
+		Cid int64 `json:"cid"`
+	}
+
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+
+	uc := ctx.MustGet("user").(ijwt.UserClaims)
+	err := h.intrSvc.Collect(ctx, h.biz, req.Id, req.Cid, uc.Uid)
+	if errors.Is(err, service.ErrCollectionNotFound) {
+		ctx.JSON(http.StatusOK, Result{Code: errs.CollectionNotFound, Msg: "收藏夹不存在"})
+		return
+	}
+	if err != nil {
+		h.l.Error("收藏失败",
+			logger.Int64("uid", uc.Uid),
+			logger.Int64("aid", req.Id),
+			logger.Int64("cid", req.Cid),
+			logger.Error(err))
+		ctx.JSON(http.StatusOK, Result{Code: errs.ArticleInternalServerError, Msg: "系统错误"})
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "OK"})
+}
+
+// CancelCollect 取消收藏,没有收藏过也返回成功
+func (h *ArticleHandler) CancelCollect(ctx *gin.Context) {
+	type Req struct {
+		Id int64 `json:"id"`
+	}
+
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+
+	uc := ctx.MustGet("user").(ijwt.UserClaims)
+	err := h.intrSvc.CancelCollect(ctx, h.biz, req.Id, uc.Uid)
+	if err != nil {
+		h.l.Error("取消收藏失败",
+			logger.Int64("uid", uc.Uid),
+			logger.Int64("aid", req.Id),
+			logger.Error(err))
+		ctx.JSON(http.StatusOK, Result{Code: errs.ArticleInternalServerError, Msg: "系统错误"})
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "OK"})
+}
+
+// visitor 匿名读者的标识,只保存 IP 和 User-Agent 的哈希
+func visitor(ctx *gin.Context) string {
+	sum := sha256.Sum256([]byte(ctx.ClientIP() + "|" + ctx.GetHeader("User-Agent")))
+	return hex.EncodeToString(sum[:16])
+}
+
+func (req ArticleReq) toDomain(uid int64) domain.Article {
+	return domain.Article{
+		Id:      req.Id,
+		Title:   req.Title,
+		Content: req.Content,
+		Author: domain.Author{
+			Id: uid,
+		},
+	}
+}
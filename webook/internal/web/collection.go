@@ -0,0 +1,247 @@
+package web
+
+import (
+	"errors"
+	"github.com/ClearloveHn/golangwebook/webook/internal/domain"
+	"github.com/ClearloveHn/golangwebook/webook/internal/errs"
+	"github.com/ClearloveHn/golangwebook/webook/internal/service"
+	ijwt "github.com/ClearloveHn/golangwebook/webook/internal/web/jwt"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
+	"github.com/ecodeclub/ekit/slice"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+	"unicode/utf8"
+)
+
+// maxCollectionNameLen 收藏夹名字的最大长度
+const maxCollectionNameLen = 64
+
+var _ handler = &CollectionHandler{}
+
+// CollectionHandler 收藏夹的 HTTP 处理器
+type CollectionHandler struct {
+	svc service.CollectionService
+	biz string
+	l   logger.LoggerV1
+}
+
+func NewCollectionHandler(svc service.CollectionService, l logger.LoggerV1) *CollectionHandler {
+	return &CollectionHandler{svc: svc, biz: "article", l: l}
+}
+
+// RegisterRoutes 注册收藏夹的路由
+func (h *CollectionHandler) RegisterRoutes(server *gin.Engine) {
+	g := server.Group("/collections")
+	g.POST("/create", h.Create)
+	g.POST("/update", h.Update)
+	g.POST("/delete", h.Delete)
+	g.POST("/list", h.List)
+	g.POST("/items", h.Items)
+	g.POST("/move", h.Move)
+}
+
+// CollectionReq 创建和修改收藏夹的请求
+type CollectionReq struct {
+	Id          int64  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Public      bool   `json:"public"`
+}
+
+func (req CollectionReq) toDomain(uid int64) domain.Collection {
+	c := domain.Collection{
+		Id:          req.Id,
+		Uid:         uid,
+		Name:        req.Name,
+		Description: req.Description,
+		Visibility:  domain.CollectionVisibilityPrivate,
+	}
+	if req.Public {
+		c.Visibility = domain.CollectionVisibilityPublic
+	}
+	return c
+}
+
+func (req CollectionReq) valid() bool {
+	return req.Name != "" && utf8.RuneCountInString(req.Name) <= maxCollectionNameLen
+}
+
+// Create 创建收藏夹
+func (h *CollectionHandler) Create(ctx *gin.Context) {
+	var req CollectionReq
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	if !req.valid() {
+		ctx.JSON(http.StatusOK, Result{Code: errs.CollectionInvalidInput, Msg: "收藏夹名字不对"})
+		return
+	}
+
+	uc := ctx.MustGet("user").(ijwt.UserClaims)
+	id, err := h.svc.Create(ctx, req.toDomain(uc.Uid))
+	if err != nil {
+		h.l.Error("创建收藏夹失败",
+			logger.Int64("uid", uc.Uid),
+			logger.Error(err))
+		ctx.JSON(http.StatusOK, Result{Code: errs.CollectionInternalServerError, Msg: "系统错误"})
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Data: id})
+}
+
+// Update 修改收藏夹的名字、描述和可见性
+func (h *CollectionHandler) Update(ctx *gin.Context) {
+	var req CollectionReq
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	if req.Id <= 0 || !req.valid() {
+		ctx.JSON(http.StatusOK, Result{Code: errs.CollectionInvalidInput, Msg: "输入有误"})
+		return
+	}
+
+	uc := ctx.MustGet("user").(ijwt.UserClaims)
+	err := h.svc.Update(ctx, req.toDomain(uc.Uid))
+	h.writeResult(ctx, err, "修改收藏夹失败", uc.Uid, req.Id)
+}
+
+// Delete 删除收藏夹,里面的收藏也会被取消
+func (h *CollectionHandler) Delete(ctx *gin.Context) {
+	type Req struct {
+		Id int64 `json:"id"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+
+	uc := ctx.MustGet("user").(ijwt.UserClaims)
+	err := h.svc.Delete(ctx, uc.Uid, req.Id)
+	h.writeResult(ctx, err, "删除收藏夹失败", uc.Uid, req.Id)
+}
+
+// List 查看收藏夹列表,uid 为 0 的时候查看自己的,查看别人的只能看到公开的
+func (h *CollectionHandler) List(ctx *gin.Context) {
+	type Req struct {
+		Uid int64 `json:"uid"`
+		Page
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	if req.Limit <= 0 || req.Limit > 100 {
+		ctx.JSON(http.StatusOK, Result{Code: errs.CollectionInvalidInput, Msg: "分页参数不对"})
+		return
+	}
+
+	uc := ctx.MustGet("user").(ijwt.UserClaims)
+	owner := req.Uid
+	if owner == 0 {
+		owner = uc.Uid
+	}
+	cs, err := h.svc.List(ctx, owner, uc.Uid, req.Offset, req.Limit)
+	if err != nil {
+		h.l.Error("查询收藏夹列表失败",
+			logger.Int64("uid", uc.Uid),
+			logger.Int64("owner", owner),
+			logger.Error(err))
+		ctx.JSON(http.StatusOK, Result{Code: errs.CollectionInternalServerError, Msg: "系统错误"})
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{
+		Data: slice.Map[domain.Collection, CollectionVO](cs,
+			func(idx int, src domain.Collection) CollectionVO {
+				return CollectionVO{
+					Id:          src.Id,
+					Uid:         src.Uid,
+					Name:        src.Name,
+					Description: src.Description,
+					Public:      src.Visibility == domain.CollectionVisibilityPublic,
+					ItemCnt:     src.ItemCnt,
+					Ctime:       src.Ctime.Format(time.DateTime),
+					Utime:       src.Utime.Format(time.DateTime),
+				}
+			}),
+	})
+}
+
+// Items 查看收藏夹里面的收藏,cid 为 0 的是自己的默认收藏夹
+func (h *CollectionHandler) Items(ctx *gin.Context) {
+	type Req struct {
+		Cid int64 `json:"cid"`
+		Page
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	if req.Limit <= 0 || req.Limit > 100 {
+		ctx.JSON(http.StatusOK, Result{Code: errs.CollectionInvalidInput, Msg: "分页参数不对"})
+		return
+	}
+
+	uc := ctx.MustGet("user").(ijwt.UserClaims)
+	items, err := h.svc.Items(ctx, req.Cid, uc.Uid, req.Offset, req.Limit)
+	if errors.Is(err, service.ErrCollectionNotFound) {
+		ctx.JSON(http.StatusOK, Result{Code: errs.CollectionNotFound, Msg: "收藏夹不存在"})
+		return
+	}
+	if err != nil {
+		h.l.Error("查询收藏夹内容失败",
+			logger.Int64("uid", uc.Uid),
+			logger.Int64("cid", req.Cid),
+			logger.Error(err))
+		ctx.JSON(http.StatusOK, Result{Code: errs.CollectionInternalServerError, Msg: "系统错误"})
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{
+		Data: slice.Map[domain.CollectionItem, CollectionItemVO](items,
+			func(idx int, src domain.CollectionItem) CollectionItemVO {
+				return CollectionItemVO{
+					Id:       src.Id,
+					Cid:      src.Cid,
+					Biz:      src.Biz,
+					BizId:    src.BizId,
+					Title:    src.Title,
+					Abstract: src.Abstract,
+					Ctime:    src.Ctime.Format(time.DateTime),
+				}
+			}),
+	})
+}
+
+// Move 把收藏的文章移动到另外一个收藏夹,cid 为 0 的是默认收藏夹
+func (h *CollectionHandler) Move(ctx *gin.Context) {
+	type Req struct {
+		Aid int64 `json:"aid"`
+		Cid int64 `json:"cid"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+
+	uc := ctx.MustGet("user").(ijwt.UserClaims)
+	err := h.svc.Move(ctx, uc.Uid, h.biz, req.Aid, req.Cid)
+	h.writeResult(ctx, err, "移动收藏失败", uc.Uid, req.Cid)
+}
+
+// writeResult 没有返回数据的接口统一处理错误
+func (h *CollectionHandler) writeResult(ctx *gin.Context, err error, msg string, uid int64, cid int64) {
+	switch {
+	case err == nil:
+		ctx.JSON(http.StatusOK, Result{Msg: "OK"})
+	case errors.Is(err, service.ErrCollectionNotFound):
+		ctx.JSON(http.StatusOK, Result{Code: errs.CollectionNotFound, Msg: "收藏夹不存在"})
+	case errors.Is(err, service.ErrCollectionItemNotFound):
+		ctx.JSON(http.StatusOK, Result{Code: errs.CollectionInvalidInput, Msg: "没有收藏过"})
+	default:
+		h.l.Error(msg,
+			logger.Int64("uid", uid),
+			logger.Int64("cid", cid),
+			logger.Error(err))
+		ctx.JSON(http.StatusOK, Result{Code: errs.CollectionInternalServerError, Msg: "系统错误"})
+	}
+}
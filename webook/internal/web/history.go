@@ -0,0 +1,217 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ClearloveHn/golangwebook/webook/internal/domain"
+	"github.com/ClearloveHn/golangwebook/webook/internal/errs"
+	"github.com/ClearloveHn/golangwebook/webook/internal/service"
+	ijwt "github.com/ClearloveHn/golangwebook/webook/internal/web/jwt"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
+	"github.com/ecodeclub/ekit/slice"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+// maxProgressDuration 一次上报的阅读时长的上限
+const maxProgressDuration = time.Minute * 10
+
+var _ handler = &HistoryHandler{}
+
+// HistoryHandler 我的浏览记录
+type HistoryHandler struct {
+	svc service.HistoryService
+	l   logger.LoggerV1
+}
+
+func NewHistoryHandler(svc service.HistoryService, l logger.LoggerV1) *HistoryHandler {
+	return &HistoryHandler{svc: svc, l: l}
+}
+
+// RegisterRoutes 注册浏览记录的路由
+func (h *HistoryHandler) RegisterRoutes(server *gin.Engine) {
+	g := server.Group("/history")
+	g.POST("/list", h.List)
+	g.POST("/delete", h.Delete)
+	g.POST("/clear", h.Clear)
+	g.POST("/progress", h.Progress)
+	g.POST("/continue", h.Continue)
+}
+
+// List 按照浏览时间倒序翻页
+func (h *HistoryHandler) List(ctx *gin.Context) {
+	var page CursorPage
+	if err := ctx.Bind(&page); err != nil {
+		return
+	}
+	if page.Limit <= 0 || page.Limit > 100 {
+		ctx.JSON(http.StatusOK, Result{Code: errs.HistoryInvalidInput, Msg: "分页参数不对"})
+		return
+	}
+	cursor, err := decodeHistoryCursor(page.Cursor)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.HistoryInvalidInput, Msg: "分页参数不对"})
+		return
+	}
+
+	uc := ctx.MustGet("user").(ijwt.UserClaims)
+	records, err := h.svc.List(ctx, uc.Uid, cursor, page.Limit)
+	if err != nil {
+		h.l.Error("查询浏览记录失败",
+			logger.Int64("uid", uc.Uid),
+			logger.String("cursor", page.Cursor),
+			logger.Error(err))
+		ctx.JSON(http.StatusOK, Result{Code: errs.HistoryInternalServerError, Msg: "系统错误"})
+		return
+	}
+
+	res := HistoryListVO{Records: h.toVOs(records)}
+	// 不够一页说明没有下一页了
+	if len(records) == page.Limit {
+		last := records[len(records)-1]
+		res.Cursor = encodeHistoryCursor(domain.HistoryCursor{Utime: last.Utime, Id: last.Id})
+	}
+	ctx.JSON(http.StatusOK, Result{Data: res})
+}
+
+// Delete 删除一条浏览记录
+func (h *HistoryHandler) Delete(ctx *gin.Context) {
+	type Req struct {
+		Id int64 `json:"id"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+
+	uc := ctx.MustGet("user").(ijwt.UserClaims)
+	err := h.svc.Delete(ctx, uc.Uid, req.Id)
+	if err != nil {
+		h.l.Error("删除浏览记录失败",
+			logger.Int64("uid", uc.Uid),
+			logger.Int64("id", req.Id),
+			logger.Error(err))
+		ctx.JSON(http.StatusOK, Result{Code: errs.HistoryInternalServerError, Msg: "系统错误"})
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "OK"})
+}
+
+// Clear 清空浏览记录
+func (h *HistoryHandler) Clear(ctx *gin.Context) {
+	uc := ctx.MustGet("user").(ijwt.UserClaims)
+	err := h.svc.Clear(ctx, uc.Uid)
+	if err != nil {
+		h.l.Error("清空浏览记录失败",
+			logger.Int64("uid", uc.Uid),
+			logger.Error(err))
+		ctx.JSON(http.StatusOK, Result{Code: errs.HistoryInternalServerError, Msg: "系统错误"})
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "OK"})
+}
+
+// Progress 客户端定期上报阅读进度,duration 是距离上一次上报的阅读时长,单位毫秒
+func (h *HistoryHandler) Progress(ctx *gin.Context) {
+	type Req struct {
+		Aid      int64 `json:"aid"`
+		Position int64 `json:"position"`
+		Progress int   `json:"progress"`
+		Duration int64 `json:"duration"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	// 上报的间隔不会很长,时长太大的直接拒绝,避免刷阅读时长
+	if req.Aid <= 0 || req.Position < 0 || req.Progress < 0 || req.Progress > 100 ||
+		req.Duration < 0 || req.Duration > maxProgressDuration.Milliseconds() {
+		ctx.JSON(http.StatusOK, Result{Code: errs.HistoryInvalidInput, Msg: "输入有误"})
+		return
+	}
+
+	uc := ctx.MustGet("user").(ijwt.UserClaims)
+	err := h.svc.ReportProgress(ctx, domain.ReadProgress{
+		Uid:      uc.Uid,
+		Biz:      "article",
+		BizId:    req.Aid,
+		Position: req.Position,
+		Progress: req.Progress,
+		Duration: time.Duration(req.Duration) * time.Millisecond,
+	})
+	if errors.Is(err, service.ErrArticleNotFound) {
+		ctx.JSON(http.StatusOK, Result{Code: errs.HistoryInvalidInput, Msg: "文章不存在"})
+		return
+	}
+	if err != nil {
+		h.l.Error("保存阅读进度失败",
+			logger.Int64("uid", uc.Uid),
+			logger.Int64("aid", req.Aid),
+			logger.Error(err))
+		ctx.JSON(http.StatusOK, Result{Code: errs.HistoryInternalServerError, Msg: "系统错误"})
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "OK"})
+}
+
+// Continue 继续阅读的列表,只有开始读了但是没有读完的文章
+func (h *HistoryHandler) Continue(ctx *gin.Context) {
+	type Req struct {
+		Limit int `json:"limit"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	if req.Limit <= 0 || req.Limit > 100 {
+		ctx.JSON(http.StatusOK, Result{Code: errs.HistoryInvalidInput, Msg: "分页参数不对"})
+		return
+	}
+
+	uc := ctx.MustGet("user").(ijwt.UserClaims)
+	records, err := h.svc.ContinueReading(ctx, uc.Uid, req.Limit)
+	if err != nil {
+		h.l.Error("查询继续阅读列表失败",
+			logger.Int64("uid", uc.Uid),
+			logger.Error(err))
+		ctx.JSON(http.StatusOK, Result{Code: errs.HistoryInternalServerError, Msg: "系统错误"})
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Data: h.toVOs(records)})
+}
+
+func (h *HistoryHandler) toVOs(records []domain.HistoryRecord) []HistoryVO {
+	return slice.Map[domain.HistoryRecord, HistoryVO](records,
+		func(idx int, src domain.HistoryRecord) HistoryVO {
+			return HistoryVO{
+				Id:       src.Id,
+				Biz:      src.Biz,
+				BizId:    src.BizId,
+				Title:    src.Title,
+				Abstract: src.Abstract,
+				Position: src.Position,
+				Progress: src.Progress,
+				Finished: src.Finished(),
+				Duration: src.Duration.Milliseconds(),
+				Utime:    src.Utime.Format(time.DateTime),
+			}
+		})
+}
+
+// encodeHistoryCursor 游标对前端来说是不透明的字符串
+func encodeHistoryCursor(c domain.HistoryCursor) string {
+	return fmt.Sprintf("%d_%d", c.Utime.UnixMilli(), c.Id)
+}
+
+func decodeHistoryCursor(s string) (domain.HistoryCursor, error) {
+	if s == "" {
+		return domain.HistoryCursor{}, nil
+	}
+	var utime, id int64
+	n, err := fmt.Sscanf(s, "%d_%d", &utime, &id)
+	if err != nil || n != 2 || utime <= 0 || id <= 0 {
+		return domain.HistoryCursor{}, errors.New("非法的游标")
+	}
+	return domain.HistoryCursor{Utime: time.UnixMilli(utime), Id: id}, nil
+}
@@ -0,0 +1,30 @@
+package web
+
+import (
+	ijwt "github.com/ClearloveHn/golangwebook/webook/internal/web/jwt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+var _ handler = &JWKSHandler{}
+
+// JWKSHandler 发布 access token 的公钥,别的服务可以用它来验证我们签发的 token
+// 注意这个路径需要加入到登录校验中间件的 IgnorePaths 里面
+type JWKSHandler struct {
+	jwtHdl ijwt.Handler
+}
+
+func NewJWKSHandler(jwtHdl ijwt.Handler) *JWKSHandler {
+	return &JWKSHandler{jwtHdl: jwtHdl}
+}
+
+func (h *JWKSHandler) RegisterRoutes(server *gin.Engine) {
+	server.GET("/.well-known/jwks.json", h.JWKS)
+}
+
+// JWKS 按照 RFC 7517 的格式返回公钥,不包装 Result
+func (h *JWKSHandler) JWKS(ctx *gin.Context) {
+	// 允许调用方缓存一段时间,轮换密钥的时候新密钥要提前发布
+	ctx.Header("Cache-Control", "public, max-age=300")
+	ctx.JSON(http.StatusOK, h.jwtHdl.JWKS())
+}
@@ -0,0 +1,272 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"sort"
+)
+
+// 签名密钥的管理
+// 同一时刻只有一个密钥用于签名,但是可以有多个密钥用于验证,
+// 这样轮换密钥的时候,用旧密钥签发的 token 在过期之前依旧可以使用。
+// 轮换的步骤:
+// 1. 把新密钥加入到 Keys 里面,先不激活,等所有的实例都加载了新密钥
+// 2. 把 Active 切换成新密钥的 kid
+// 3. 等旧密钥签发的 token 全部过期之后,再把旧密钥从 Keys 里面删掉
+
+var (
+	ErrInvalidToken  = errors.New("token 无效")
+	ErrUnknownKid    = errors.New("未知的 kid")
+	ErrKeyNotSigning = errors.New("密钥不能用于签名")
+	ErrKeyMismatch   = errors.New("公钥和私钥不匹配")
+)
+
+// KeyConfig 单个密钥的配置
+type KeyConfig struct {
+	Kid string `yaml:"kid"`
+	// Alg 签名算法,支持 HS256/HS384/HS512、RS256/RS384/RS512、ES256/ES384/ES512
+	Alg string `yaml:"alg"`
+	// Secret HMAC 算法的密钥
+	Secret string `yaml:"secret"`
+	// PrivateKey PEM 格式的私钥,只用于验证的旧密钥可以不配置
+	PrivateKey string `yaml:"privateKey"`
+	// PublicKey PEM 格式的公钥,没有配置的时候从私钥里面推导,和私钥一起配置的时候必须是一对
+	PublicKey string `yaml:"publicKey"`
+}
+
+// KeySetConfig 一组密钥的配置
+type KeySetConfig struct {
+	// Active 用于签名的密钥的 kid
+	Active string      `yaml:"active"`
+	Keys   []KeyConfig `yaml:"keys"`
+}
+
+// key 表示一个可以用于签名或者验证的密钥
+type key struct {
+	kid       string
+	method    jwt.SigningMethod
+	signKey   any // HMAC 是 []byte,非对称算法是私钥,只用于验证的时候是 nil
+	verifyKey any // HMAC 是 []byte,非对称算法是公钥
+}
+
+// KeySet 一组密钥,其中 active 用于签名,keys 里面的所有密钥都可以用于验证
+type KeySet struct {
+	active *key
+	keys   map[string]*key
+	algs   []string
+}
+
+// NewKeySet 根据配置创建 KeySet
+func NewKeySet(cfg KeySetConfig) (*KeySet, error) {
+	ks := &KeySet{keys: make(map[string]*key, len(cfg.Keys))}
+	for _, kc := range cfg.Keys {
+		k, err := newKey(kc)
+		if err != nil {
+			return nil, fmt.Errorf("加载密钥 %s 失败 %w", kc.Kid, err)
+		}
+		if _, ok := ks.keys[k.kid]; ok {
+			return nil, fmt.Errorf("重复的 kid %s", k.kid)
+		}
+		ks.keys[k.kid] = k
+		ks.algs = append(ks.algs, k.method.Alg())
+	}
+
+	active, ok := ks.keys[cfg.Active]
+	if !ok {
+		return nil, fmt.Errorf("找不到用于签名的密钥 %s", cfg.Active)
+	}
+	if active.signKey == nil {
+		return nil, fmt.Errorf("密钥 %s 没有配置私钥 %w", cfg.Active, ErrKeyNotSigning)
+	}
+	ks.active = active
+	return ks, nil
+}
+
+// NewHMACKeySet 创建只有一个 HS512 密钥的 KeySet
+func NewHMACKeySet(kid string, secret []byte) *KeySet {
+	k := &key{
+		kid:       kid,
+		method:    jwt.SigningMethodHS512,
+		signKey:   secret,
+		verifyKey: secret,
+	}
+	return &KeySet{
+		active: k,
+		keys:   map[string]*key{kid: k},
+		algs:   []string{k.method.Alg()},
+	}
+}
+
+// Sign 使用 active 密钥签名,并且在头部带上 kid
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.active.method, claims)
+	token.Header["kid"] = ks.active.kid
+	return token.SignedString(ks.active.signKey)
+}
+
+// Parse 解析并校验 token,结果放在 claims 里面
+func (ks *KeySet) Parse(tokenStr string, claims jwt.Claims) error {
+	token, err := jwt.ParseWithClaims(tokenStr, claims, ks.keyFunc,
+		jwt.WithValidMethods(ks.algs))
+	if err != nil {
+		return err
+	}
+	if token == nil || !token.Valid {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// keyFunc 根据 token 头部的 kid 找到验证用的密钥
+func (ks *KeySet) keyFunc(token *jwt.Token) (any, error) {
+	k := ks.active
+	kid, ok := token.Header["kid"].(string)
+	if ok {
+		k, ok = ks.keys[kid]
+		if !ok {
+			return nil, ErrUnknownKid
+		}
+	}
+	// 没有 kid 的是引入 kid 之前签发的 token,用 active 密钥验证
+	// 算法必须和密钥的算法一致,防止算法混淆攻击
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, ErrInvalidToken
+	}
+	return k.verifyKey, nil
+}
+
+// JWKS 返回所有非对称密钥的公钥,HMAC 的密钥永远不会对外公开
+func (ks *KeySet) JWKS() JWKSet {
+	res := JWKSet{Keys: make([]JWK, 0, len(ks.keys))}
+	for _, k := range ks.keys {
+		jwk, ok := k.jwk()
+		if ok {
+			res.Keys = append(res.Keys, jwk)
+		}
+	}
+	// map 的遍历顺序是随机的,排个序保证输出稳定
+	sort.Slice(res.Keys, func(i, j int) bool {
+		return res.Keys[i].Kid < res.Keys[j].Kid
+	})
+	return res
+}
+
+// JWKSet 对应 RFC 7517 的 JWK Set
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK 对应 RFC 7517 的 JSON Web Key,只包含公钥部分
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+func (k *key) jwk() (JWK, bool) {
+	enc := base64.RawURLEncoding
+	switch pub := k.verifyKey.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			Kid: k.kid,
+			Use: "sig",
+			Alg: k.method.Alg(),
+			N:   enc.EncodeToString(pub.N.Bytes()),
+			E:   enc.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}, true
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		return JWK{
+			Kty: "EC",
+			Kid: k.kid,
+			Use: "sig",
+			Alg: k.method.Alg(),
+			Crv: pub.Curve.Params().Name,
+			X:   enc.EncodeToString(pub.X.FillBytes(make([]byte, size))),
+			Y:   enc.EncodeToString(pub.Y.FillBytes(make([]byte, size))),
+		}, true
+	default:
+		return JWK{}, false
+	}
+}
+
+func newKey(cfg KeyConfig) (*key, error) {
+	if cfg.Kid == "" {
+		return nil, errors.New("kid 不能为空")
+	}
+	method := jwt.GetSigningMethod(cfg.Alg)
+	k := &key{kid: cfg.Kid, method: method}
+
+	var err error
+	switch method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if cfg.Secret == "" {
+			return nil, errors.New("HMAC 算法必须配置 secret")
+		}
+		k.signKey = []byte(cfg.Secret)
+		k.verifyKey = k.signKey
+	case *jwt.SigningMethodRSA:
+		var priv *rsa.PrivateKey
+		if cfg.PrivateKey != "" {
+			priv, err = jwt.ParseRSAPrivateKeyFromPEM([]byte(cfg.PrivateKey))
+			if err != nil {
+				return nil, err
+			}
+			k.signKey = priv
+			k.verifyKey = &priv.PublicKey
+		}
+		if cfg.PublicKey != "" {
+			var pub *rsa.PublicKey
+			pub, err = jwt.ParseRSAPublicKeyFromPEM([]byte(cfg.PublicKey))
+			if err != nil {
+				return nil, err
+			}
+			if priv != nil && !priv.PublicKey.Equal(pub) {
+				return nil, ErrKeyMismatch
+			}
+			k.verifyKey = pub
+		}
+	case *jwt.SigningMethodECDSA:
+		var priv *ecdsa.PrivateKey
+		if cfg.PrivateKey != "" {
+			priv, err = jwt.ParseECPrivateKeyFromPEM([]byte(cfg.PrivateKey))
+			if err != nil {
+				return nil, err
+			}
+			k.signKey = priv
+			k.verifyKey = &priv.PublicKey
+		}
+		if cfg.PublicKey != "" {
+			var pub *ecdsa.PublicKey
+			pub, err = jwt.ParseECPublicKeyFromPEM([]byte(cfg.PublicKey))
+			if err != nil {
+				return nil, err
+			}
+			if priv != nil && !priv.PublicKey.Equal(pub) {
+				return nil, ErrKeyMismatch
+			}
+			k.verifyKey = pub
+		}
+	default:
+		return nil, fmt.Errorf("不支持的签名算法 %s", cfg.Alg)
+	}
+
+	if k.verifyKey == nil {
+		return nil, errors.New("非对称算法必须配置私钥或者公钥")
+	}
+	return k, nil
+}
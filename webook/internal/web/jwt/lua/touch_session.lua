@@ -0,0 +1,9 @@
+-- 会话信息
+local key = KEYS[1]
+
+-- 会话已经过期了就不要再写,否则会重新创建一个没有过期时间的会话
+if redis.call("EXISTS", key) == 0 then
+    return 0
+end
+redis.call("HSET", key, ARGV[1], ARGV[2])
+return 1
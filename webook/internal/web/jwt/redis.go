@@ -1,27 +1,57 @@
 package jwt
 
 import (
+	"context"
+	_ "embed"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
+var (
+	//go:embed lua/touch_session.lua
+	luaTouchSession string
+)
+
+// ErrSessionNotFound 会话不存在,或者不属于该用户
+var ErrSessionNotFound = errors.New("会话不存在")
+
+const (
+	fieldUserAgent   = "user_agent"
+	fieldIp          = "ip"
+	fieldLoginTime   = "login_time"
+	fieldLastRefresh = "last_refresh"
+)
+
 type RedisJWTHandler struct {
-	client        redis.Cmdable
-	signingMethod jwt.SigningMethod
-	rcExpiration  time.Duration
+	client       redis.Cmdable
+	atKeys       *KeySet // access token 的密钥
+	rcKeys       *KeySet // refresh token 的密钥
+	rcExpiration time.Duration
 }
 
+// NewRedisJWTHandler 使用默认的 HMAC 密钥 JWTKey 和 RCJWTKey
 func NewRedisJWTHandler(client redis.Cmdable) Handler {
+	return NewRedisJWTHandlerWithKeys(client,
+		NewHMACKeySet("at-default", JWTKey),
+		NewHMACKeySet("rc-default", RCJWTKey))
+}
+
+// NewRedisJWTHandlerWithKeys 使用配置的密钥,
+// access token 可以使用非对称算法,这样别的服务只需要公钥就可以验证 token
+func NewRedisJWTHandlerWithKeys(client redis.Cmdable, atKeys *KeySet, rcKeys *KeySet) Handler {
 	return &RedisJWTHandler{
-		client:        client,
-		signingMethod: jwt.SigningMethodHS512,
-		rcExpiration:  time.Hour * 24 * 7,
+		client:       client,
+		atKeys:       atKeys,
+		rcKeys:       rcKeys,
+		rcExpiration: time.Hour * 24 * 7,
 	}
 }
 
@@ -54,12 +84,35 @@ func (h *RedisJWTHandler) ExtractToken(ctx *gin.Context) string {
 	return segs[1]
 }
 
+// ParseAccessToken 解析并校验 access token
+func (h *RedisJWTHandler) ParseAccessToken(tokenStr string) (UserClaims, error) {
+	var uc UserClaims
+	err := h.atKeys.Parse(tokenStr, &uc)
+	return uc, err
+}
+
+// ParseRefreshToken 解析并校验 refresh token
+func (h *RedisJWTHandler) ParseRefreshToken(tokenStr string) (RefreshClaims, error) {
+	var rc RefreshClaims
+	err := h.rcKeys.Parse(tokenStr, &rc)
+	return rc, err
+}
+
+// JWKS 返回 access token 的公钥,用于发布到 /.well-known/jwks.json
+func (h *RedisJWTHandler) JWKS() JWKSet {
+	return h.atKeys.JWKS()
+}
+
 func (h *RedisJWTHandler) SetLoginToken(ctx *gin.Context, uid int64) error {
 	ssid := uuid.New().String()
 	err := h.setRefreshToken(ctx, uid, ssid)
 	if err != nil {
 		return err
 	}
+	err = h.addSession(ctx, uid, ssid)
+	if err != nil {
+		return err
+	}
 	return h.SetJWTToken(ctx, uid, ssid)
 }
 
@@ -68,9 +121,147 @@ func (h *RedisJWTHandler) ClearToken(ctx *gin.Context) error {
 	ctx.Header("x-refresh-token", "")
 	uc := ctx.MustGet("user").(UserClaims)
 
-	return h.client.Set(ctx,
-		fmt.Sprintf("users:ssid:%s", uc.Ssid),
-		"", h.rcExpiration).Err()
+	// 标记退出登录,同时删除会话信息
+	err := h.revokeSessions(ctx, uc.Ssid)
+	if err != nil {
+		return err
+	}
+	return h.client.SRem(ctx, h.sessionsKey(uc.Uid), uc.Ssid).Err()
+}
+
+// ListSessions 列出用户所有还有效的会话,按照登录时间倒序
+func (h *RedisJWTHandler) ListSessions(ctx context.Context, uid int64) ([]Session, error) {
+	ssids, err := h.client.SMembers(ctx, h.sessionsKey(uid)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(ssids) == 0 {
+		return []Session{}, nil
+	}
+
+	pipe := h.client.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, 0, len(ssids))
+	for _, ssid := range ssids {
+		cmds = append(cmds, pipe.HGetAll(ctx, h.sessionKey(ssid)))
+	}
+	_, err = pipe.Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Session, 0, len(ssids))
+	expired := make([]any, 0)
+	for i, cmd := range cmds {
+		vals := cmd.Val()
+		if len(vals) == 0 {
+			// 会话已经过期了,顺手从索引里面删掉
+			expired = append(expired, ssids[i])
+			continue
+		}
+		loginTime, _ := strconv.ParseInt(vals[fieldLoginTime], 10, 64)
+		lastRefresh, _ := strconv.ParseInt(vals[fieldLastRefresh], 10, 64)
+		res = append(res, Session{
+			Ssid:        ssids[i],
+			UserAgent:   vals[fieldUserAgent],
+			Ip:          vals[fieldIp],
+			LoginTime:   time.UnixMilli(loginTime),
+			LastRefresh: time.UnixMilli(lastRefresh),
+		})
+	}
+	if len(expired) > 0 {
+		// 清理失败也没关系,下次还会再清理
+		_ = h.client.SRem(ctx, h.sessionsKey(uid), expired...).Err()
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].LoginTime.After(res[j].LoginTime)
+	})
+	return res, nil
+}
+
+// ClearSession 让用户的某一个会话失效
+// 只能操作属于该用户的会话,否则返回 ErrSessionNotFound
+func (h *RedisJWTHandler) ClearSession(ctx context.Context, uid int64, ssid string) error {
+	cnt, err := h.client.SRem(ctx, h.sessionsKey(uid), ssid).Result()
+	if err != nil {
+		return err
+	}
+	if cnt == 0 {
+		return ErrSessionNotFound
+	}
+	return h.revokeSessions(ctx, ssid)
+}
+
+// ClearAllSessions 让用户所有的会话都失效
+// 会话的键分散在不同的 slot 上,所以不用 lua 脚本,而是先读出索引再逐个失效,
+// 最后只从索引里面删除读出来的 ssid,并发登录产生的新会话不受影响
+func (h *RedisJWTHandler) ClearAllSessions(ctx context.Context, uid int64) error {
+	ssids, err := h.client.SMembers(ctx, h.sessionsKey(uid)).Result()
+	if err != nil || len(ssids) == 0 {
+		return err
+	}
+	// 先失效再删除索引,中途失败的话索引还在,可以重试
+	err = h.revokeSessions(ctx, ssids...)
+	if err != nil {
+		return err
+	}
+	members := make([]any, 0, len(ssids))
+	for _, ssid := range ssids {
+		members = append(members, ssid)
+	}
+	return h.client.SRem(ctx, h.sessionsKey(uid), members...).Err()
+}
+
+// revokeSessions 把 ssid 标记为已经退出登录,并删除会话信息
+// 这些键不在同一个 slot 上,只用 pipeline 批量发送,先写退出登录的标记再删除会话信息
+func (h *RedisJWTHandler) revokeSessions(ctx context.Context, ssids ...string) error {
+	if len(ssids) == 0 {
+		return nil
+	}
+	_, err := h.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, ssid := range ssids {
+			pipe.Set(ctx, fmt.Sprintf("users:ssid:%s", ssid), "", h.rcExpiration)
+			pipe.Del(ctx, h.sessionKey(ssid))
+		}
+		return nil
+	})
+	return err
+}
+
+// addSession 记录一次登录产生的会话,并且加入到用户的会话索引里面
+// 会话和 refresh token 的过期时间保持一致
+func (h *RedisJWTHandler) addSession(ctx *gin.Context, uid int64, ssid string) error {
+	now := time.Now().UnixMilli()
+	sessionKey := h.sessionKey(ssid)
+	sessionsKey := h.sessionsKey(uid)
+	_, err := h.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, sessionKey,
+			fieldUserAgent, ctx.GetHeader("User-Agent"),
+			fieldIp, ctx.ClientIP(),
+			fieldLoginTime, now,
+			fieldLastRefresh, now)
+		pipe.Expire(ctx, sessionKey, h.rcExpiration)
+		pipe.SAdd(ctx, sessionsKey, ssid)
+		pipe.Expire(ctx, sessionsKey, h.rcExpiration)
+		return nil
+	})
+	return err
+}
+
+// touchSession 更新会话最近一次刷新的时间,会话不存在的时候什么也不做
+func (h *RedisJWTHandler) touchSession(ctx context.Context, ssid string) error {
+	return h.client.Eval(ctx, luaTouchSession, []string{h.sessionKey(ssid)},
+		fieldLastRefresh, time.Now().UnixMilli()).Err()
+}
+
+// sessionKey 单个会话信息的键
+func (h *RedisJWTHandler) sessionKey(ssid string) string {
+	return fmt.Sprintf("users:session:%s", ssid)
+}
+
+// sessionsKey 用户会话索引的键,里面存放的是 ssid
+func (h *RedisJWTHandler) sessionsKey(uid int64) string {
+	return fmt.Sprintf("users:sessions:%d", uid)
 }
 
 func (h *RedisJWTHandler) SetJWTToken(ctx *gin.Context, uid int64, ssid string) error {
@@ -83,12 +274,13 @@ func (h *RedisJWTHandler) SetJWTToken(ctx *gin.Context, uid int64, ssid string)
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute * 30)),
 		},
 	}
-	token := jwt.NewWithClaims(h.signingMethod, uc)
-	tokenStr, err := token.SignedString(JWTKey)
+	tokenStr, err := h.atKeys.Sign(uc)
 	if err != nil {
 		return err
 	}
 	ctx.Header("x-jwt-token", tokenStr)
+	// 会话信息只是辅助信息,更新失败不影响 token 的签发
+	_ = h.touchSession(ctx, ssid)
 	return nil
 }
 
@@ -100,8 +292,7 @@ func (h *RedisJWTHandler) setRefreshToken(ctx *gin.Context, uid int64, ssid stri
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(h.rcExpiration)),
 		},
 	}
-	token := jwt.NewWithClaims(h.signingMethod, rc)
-	tokenStr, err := token.SignedString(RCJWTKey)
+	tokenStr, err := h.rcKeys.Sign(rc)
 	if err != nil {
 		return err
 	}
@@ -109,6 +300,7 @@ func (h *RedisJWTHandler) setRefreshToken(ctx *gin.Context, uid int64, ssid stri
 	return nil
 }
 
+// JWTKey 和 RCJWTKey 是默认的 HMAC 密钥,生产环境应该通过 NewRedisJWTHandlerWithKeys 配置
 var JWTKey = []byte("k6CswdUm77WKcbM68UQUuxVsHSpTCwgK")
 var RCJWTKey = []byte("k6CswdUm77WKcbM68UQUuxVsHSpTCwgA")
 
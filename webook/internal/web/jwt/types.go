@@ -1,6 +1,10 @@
 package jwt
 
-import "github.com/gin-gonic/gin"
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"time"
+)
 
 type Handler interface {
 	ClearToken(ctx *gin.Context) error
@@ -8,4 +12,27 @@ type Handler interface {
 	SetLoginToken(ctx *gin.Context, uid int64) error
 	SetJWTToken(ctx *gin.Context, uid int64, ssid string) error
 	CheckSession(ctx *gin.Context, ssid string) error
+
+	// ParseAccessToken 解析并校验 access token
+	ParseAccessToken(tokenStr string) (UserClaims, error)
+	// ParseRefreshToken 解析并校验 refresh token
+	ParseRefreshToken(tokenStr string) (RefreshClaims, error)
+	// JWKS 返回可以公开的验证密钥
+	JWKS() JWKSet
+
+	// ListSessions 列出用户所有还有效的登录会话,也就是登录过的设备
+	ListSessions(ctx context.Context, uid int64) ([]Session, error)
+	// ClearSession 让用户的某一个会话失效,也就是踢掉某一个设备
+	ClearSession(ctx context.Context, uid int64, ssid string) error
+	// ClearAllSessions 让用户所有的会话失效,例如修改密码之后要强制所有设备重新登录
+	ClearAllSessions(ctx context.Context, uid int64) error
+}
+
+// Session 表示一次登录产生的会话,一个 ssid 对应一个设备
+type Session struct {
+	Ssid        string    // 会话 ID
+	UserAgent   string    // 登录时的 User-Agent
+	Ip          string    // 登录时的 IP
+	LoginTime   time.Time // 登录时间
+	LastRefresh time.Time // 最近一次刷新 access token 的时间
 }
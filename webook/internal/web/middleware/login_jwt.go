@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	ijwt "github.com/ClearloveHn/golangwebook/webook/internal/web/jwt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+// LoginJWTMiddlewareBuilder 用于构建 JWT 登录校验的中间件
+type LoginJWTMiddlewareBuilder struct {
+	paths         []string // 不需要登录校验的路径
+	optionalPaths []string // 登录不是必须的路径,登录了就带上用户信息
+	ijwt.Handler
+}
+
+func NewLoginJWTMiddlewareBuilder(hdl ijwt.Handler) *LoginJWTMiddlewareBuilder {
+	return &LoginJWTMiddlewareBuilder{
+		Handler: hdl,
+	}
+}
+
+// IgnorePaths 设置不需要登录校验的路径,支持链式调用
+// 路径的写法和 gin 的路由一样,例如 /articles/pub/:id 和 /oauth2/wechat/*any
+func (m *LoginJWTMiddlewareBuilder) IgnorePaths(path string) *LoginJWTMiddlewareBuilder {
+	m.paths = append(m.paths, path)
+	return m
+}
+
+// OptionalPaths 设置登录不是必须的路径,写法和 IgnorePaths 一样
+// 没有登录,或者 token 校验不通过的,当作匿名用户,不会设置 "user";
+// 校验通过的和别的路径一样,把 ijwt.UserClaims 放到 "user" 里面
+// 例如 /articles/pub/:id,匿名读者也能看文章,登录了的读者还能看到自己有没有点赞收藏
+func (m *LoginJWTMiddlewareBuilder) OptionalPaths(path string) *LoginJWTMiddlewareBuilder {
+	m.optionalPaths = append(m.optionalPaths, path)
+	return m
+}
+
+// Build 构建中间件
+// 校验通过之后,会把 ijwt.UserClaims 放到 gin.Context 的 "user" 里面
+func (m *LoginJWTMiddlewareBuilder) Build() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		path := ctx.Request.URL.Path
+		// 不需要登录校验的
+		if matchAny(m.paths, path) {
+			return
+		}
+
+		uc, ok := m.check(ctx)
+		if ok {
+			ctx.Set("user", uc)
+			return
+		}
+		if matchAny(m.optionalPaths, path) {
+			// 当作匿名用户
+			return
+		}
+		// 没登录,token 被篡改,或者已经过期了
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+	}
+}
+
+// check 校验 token,不通过的时候返回 false
+func (m *LoginJWTMiddlewareBuilder) check(ctx *gin.Context) (ijwt.UserClaims, bool) {
+	tokenStr := m.ExtractToken(ctx)
+	if tokenStr == "" {
+		return ijwt.UserClaims{}, false
+	}
+	uc, err := m.ParseAccessToken(tokenStr)
+	if err != nil {
+		return ijwt.UserClaims{}, false
+	}
+
+	if uc.UserAgent != ctx.GetHeader("User-Agent") {
+		// 换了一个浏览器,严重的安全问题
+		// 这里要加监控
+		return ijwt.UserClaims{}, false
+	}
+
+	// 检查这个 ssid 是不是已经退出登录了
+	err = m.CheckSession(ctx, uc.Ssid)
+	if err != nil {
+		// 要么 redis 有问题,要么已经退出登录
+		return ijwt.UserClaims{}, false
+	}
+	return uc, true
+}
+
+func matchAny(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		if matchPath(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPath 按照 gin 路由的写法匹配路径
+// :name 匹配一段非空的路径,*name 只能放在最后,匹配剩下的所有路径
+func matchPath(pattern, path string) bool {
+	if pattern == path {
+		return true
+	}
+	ps := strings.Split(strings.Trim(pattern, "/"), "/")
+	segs := strings.Split(strings.Trim(path, "/"), "/")
+	for i, p := range ps {
+		if strings.HasPrefix(p, "*") {
+			return i == len(ps)-1
+		}
+		if i >= len(segs) {
+			return false
+		}
+		if strings.HasPrefix(p, ":") {
+			if segs[i] == "" {
+				return false
+			}
+			continue
+		}
+		if p != segs[i] {
+			return false
+		}
+	}
+	return len(ps) == len(segs)
+}
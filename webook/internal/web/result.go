@@ -0,0 +1,8 @@
+package web
+
+// Result 统一的 HTTP 响应结构体
+type Result struct {
+	Code int    `json:"code"` // 业务错误码,0 表示成功
+	Msg  string `json:"msg"`  // 提示信息
+	Data any    `json:"data"` // 响应数据
+}
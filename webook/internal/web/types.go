@@ -0,0 +1,8 @@
+package web
+
+import "github.com/gin-gonic/gin"
+
+// handler 所有的 Handler 都需要实现的接口,用于注册路由
+type handler interface {
+	RegisterRoutes(server *gin.Engine)
+}
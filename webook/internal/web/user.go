@@ -0,0 +1,390 @@
+package web
+
+import (
+	"errors"
+	"github.com/ClearloveHn/golangwebook/webook/internal/domain"
+	"github.com/ClearloveHn/golangwebook/webook/internal/errs"
+	"github.com/ClearloveHn/golangwebook/webook/internal/service"
+	ijwt "github.com/ClearloveHn/golangwebook/webook/internal/web/jwt"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
+	regexp "github.com/dlclark/regexp2"
+	"github.com/ecodeclub/ekit/slice"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+const (
+	// emailRegexPattern 邮箱格式的正则表达式
+	emailRegexPattern = "^\\w+([-+.]\\w+)*@\\w+([-.]\\w+)*\\.\\w+([-.]\\w+)*$"
+	// passwordRegexPattern 密码格式的正则表达式:必须包含字母、数字、特殊字符,并且不少于八位
+	passwordRegexPattern = `^(?=.*[A-Za-z])(?=.*\d)(?=.*[$@$!%*#?&])[A-Za-z\d$@$!%*#?&]{8,}$`
+	// bizLogin 短信验证码登录的业务标识
+	bizLogin = "login"
+)
+
+var _ handler = &UserHandler{}
+
+// UserHandler 用户模块的 HTTP 处理器
+type UserHandler struct {
+	ijwt.Handler
+	emailRexExp    *regexp.Regexp
+	passwordRexExp *regexp.Regexp
+	svc            service.UserService
+	codeSvc        service.CodeService
+	l              logger.LoggerV1
+}
+
+func NewUserHandler(svc service.UserService,
+	codeSvc service.CodeService, jwtHdl ijwt.Handler, l logger.LoggerV1) *UserHandler {
+	return &UserHandler{
+		emailRexExp:    regexp.MustCompile(emailRegexPattern, regexp.None),
+		passwordRexExp: regexp.MustCompile(passwordRegexPattern, regexp.None),
+		svc:            svc,
+		codeSvc:        codeSvc,
+		Handler:        jwtHdl,
+		l:              l,
+	}
+}
+
+// RegisterRoutes 注册用户模块的路由
+func (h *UserHandler) RegisterRoutes(server *gin.Engine) {
+	ug := server.Group("/users")
+	ug.POST("/signup", h.SignUp)
+	ug.POST("/login", h.LoginJWT)
+	ug.POST("/logout", h.LogoutJWT)
+	ug.POST("/refresh_token", h.RefreshToken)
+	ug.POST("/edit", h.Edit)
+	ug.GET("/profile", h.Profile)
+
+	// 登录设备管理
+	ug.GET("/sessions", h.Sessions)
+	ug.POST("/sessions/logout", h.LogoutSession)
+	ug.POST("/sessions/logout_all", h.LogoutAllSessions)
+
+	// 手机验证码登录相关功能
+	ug.POST("/login_sms/code/send", h.SendSMSLoginCode)
+	ug.POST("/login_sms", h.LoginSMS)
+}
+
+// SignUp 邮箱注册
+func (h *UserHandler) SignUp(ctx *gin.Context) {
+	type SignUpReq struct {
+		Email           string `json:"email"`
+		Password        string `json:"password"`
+		ConfirmPassword string `json:"confirmPassword"`
+	}
+
+	var req SignUpReq
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+
+	isEmail, err := h.emailRexExp.MatchString(req.Email)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+	if !isEmail {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "非法邮箱格式"})
+		return
+	}
+
+	if req.Password != req.ConfirmPassword {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "两次输入的密码不相等"})
+		return
+	}
+
+	isPassword, err := h.passwordRexExp.MatchString(req.Password)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+	if !isPassword {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput,
+			Msg: "密码必须包含字母、数字、特殊字符，并且不少于八位"})
+		return
+	}
+
+	err = h.svc.Signup(ctx, domain.User{
+		Email:    req.Email,
+		Password: req.Password,
+	})
+	switch {
+	case err == nil:
+		ctx.JSON(http.StatusOK, Result{Msg: "注册成功"})
+	case errors.Is(err, service.ErrDuplicateEmail):
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserDuplicateEmail, Msg: "邮箱冲突"})
+	default:
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+	}
+}
+
+// LoginJWT 邮箱密码登录,登录成功后在响应头里面返回 token
+func (h *UserHandler) LoginJWT(ctx *gin.Context) {
+	type LoginReq struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	var req LoginReq
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+
+	u, err := h.svc.Login(ctx, req.Email, req.Password)
+	switch {
+	case err == nil:
+		err = h.SetLoginToken(ctx, u.Id)
+		if err != nil {
+			ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+			return
+		}
+		ctx.JSON(http.StatusOK, Result{Msg: "登录成功"})
+	case errors.Is(err, service.ErrInvalidUserOrPassword):
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidOrPassword, Msg: "用户名或者密码不对"})
+	default:
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+	}
+}
+
+// LogoutJWT 退出登录,当前的 ssid 会被标记为失效
+func (h *UserHandler) LogoutJWT(ctx *gin.Context) {
+	err := h.ClearToken(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "退出登录成功"})
+}
+
+// RefreshToken 使用 refresh token 换取新的 access token
+// refresh token 和 access token 一样,放在 Authorization 头部里面
+func (h *UserHandler) RefreshToken(ctx *gin.Context) {
+	tokenStr := h.ExtractToken(ctx)
+	rc, err := h.ParseRefreshToken(tokenStr)
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	// 已经退出登录的 ssid,不能再刷新
+	err = h.CheckSession(ctx, rc.Ssid)
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	err = h.SetJWTToken(ctx, rc.Uid, rc.Ssid)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "刷新成功"})
+}
+
+// Sessions 列出当前用户所有登录的设备
+func (h *UserHandler) Sessions(ctx *gin.Context) {
+	uc := ctx.MustGet("user").(ijwt.UserClaims)
+	sessions, err := h.ListSessions(ctx, uc.Uid)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{
+		Data: slice.Map(sessions, func(idx int, src ijwt.Session) SessionVO {
+			return SessionVO{
+				Ssid:        src.Ssid,
+				UserAgent:   src.UserAgent,
+				Ip:          src.Ip,
+				LoginTime:   src.LoginTime.Format(time.DateTime),
+				LastRefresh: src.LastRefresh.Format(time.DateTime),
+				Current:     src.Ssid == uc.Ssid,
+			}
+		}),
+	})
+}
+
+// LogoutSession 让某一个设备退出登录
+func (h *UserHandler) LogoutSession(ctx *gin.Context) {
+	type Req struct {
+		Ssid string `json:"ssid"`
+	}
+
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+
+	uc := ctx.MustGet("user").(ijwt.UserClaims)
+	err := h.ClearSession(ctx, uc.Uid, req.Ssid)
+	switch {
+	case err == nil:
+		if req.Ssid == uc.Ssid {
+			// 踢掉的是自己
+			ctx.Header("x-jwt-token", "")
+			ctx.Header("x-refresh-token", "")
+		}
+		ctx.JSON(http.StatusOK, Result{Msg: "OK"})
+	case errors.Is(err, ijwt.ErrSessionNotFound):
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "设备不存在"})
+	default:
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+	}
+}
+
+// LogoutAllSessions 让所有的设备退出登录,包括当前设备
+func (h *UserHandler) LogoutAllSessions(ctx *gin.Context) {
+	uc := ctx.MustGet("user").(ijwt.UserClaims)
+	err := h.ClearAllSessions(ctx, uc.Uid)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+	ctx.Header("x-jwt-token", "")
+	ctx.Header("x-refresh-token", "")
+	ctx.JSON(http.StatusOK, Result{Msg: "OK"})
+}
+
+// SendSMSLoginCode 发送登录验证码
+func (h *UserHandler) SendSMSLoginCode(ctx *gin.Context) {
+	type Req struct {
+		Phone string `json:"phone"`
+	}
+
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+
+	// 这边可以校验 Req
+	if req.Phone == "" {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "请输入手机号码"})
+		return
+	}
+
+	err := h.codeSvc.Send(ctx, bizLogin, req.Phone)
+	switch {
+	case err == nil:
+		ctx.JSON(http.StatusOK, Result{Msg: "发送成功"})
+	case errors.Is(err, service.ErrCodeSendTooMany):
+		// 少数这种错误,是可以接受的
+		// 但是频繁出现,就代表有人在搞你的系统
+		h.l.Warn("频繁发送验证码")
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "短信发送太频繁，请稍后再试"})
+	default:
+		h.l.Error("发送验证码失败", logger.Error(err))
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+	}
+}
+
+// LoginSMS 手机验证码登录,用户不存在的时候会自动注册
+func (h *UserHandler) LoginSMS(ctx *gin.Context) {
+	type Req struct {
+		Phone string `json:"phone"`
+		Code  string `json:"code"`
+	}
+
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+
+	ok, err := h.codeSvc.Verify(ctx, bizLogin, req.Phone, req.Code)
+	if err != nil {
+		h.l.Error("手机验证码验证失败", logger.Error(err))
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+	if !ok {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "验证码不对，请重新输入"})
+		return
+	}
+
+	u, err := h.svc.FindOrCreate(ctx, req.Phone)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+
+	err = h.SetLoginToken(ctx, u.Id)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "登录成功"})
+}
+
+// Edit 修改用户的非敏感信息
+func (h *UserHandler) Edit(ctx *gin.Context) {
+	type Req struct {
+		// 注意,其它字段,尤其是密码、邮箱和手机,
+		// 修改都要通过别的手段
+		// 邮箱和手机都要验证
+		// 密码更加不用多说了
+		Nickname string `json:"nickname"`
+		// 2023-01-01
+		Birthday string `json:"birthday"`
+		AboutMe  string `json:"aboutMe"`
+	}
+
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+
+	if req.Nickname == "" {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "昵称不能为空"})
+		return
+	}
+	if len(req.AboutMe) > 1024 {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "关于我过长"})
+		return
+	}
+	birthday, err := time.Parse(time.DateOnly, req.Birthday)
+	if err != nil {
+		// 也就是说,我们其实并没有直接校验具体的格式
+		// 而是如果你能转化过来,那就说明没问题
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "日期格式不对"})
+		return
+	}
+
+	uc := ctx.MustGet("user").(ijwt.UserClaims)
+	err = h.svc.UpdateNonSensitiveInfo(ctx, domain.User{
+		Id:       uc.Uid,
+		Nickname: req.Nickname,
+		AboutMe:  req.AboutMe,
+		Birthday: birthday,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "OK"})
+}
+
+// Profile 查看个人信息
+func (h *UserHandler) Profile(ctx *gin.Context) {
+	type Profile struct {
+		Email    string `json:"email"`
+		Phone    string `json:"phone"`
+		Nickname string `json:"nickname"`
+		Birthday string `json:"birthday"`
+		AboutMe  string `json:"aboutMe"`
+	}
+
+	uc := ctx.MustGet("user").(ijwt.UserClaims)
+	u, err := h.svc.FindById(ctx, uc.Uid)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, Result{Data: Profile{
+		Email:    u.Email,
+		Phone:    u.Phone,
+		Nickname: u.Nickname,
+		Birthday: u.Birthday.Format(time.DateOnly),
+		AboutMe:  u.AboutMe,
+	}})
+}
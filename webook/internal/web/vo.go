@@ -0,0 +1,107 @@
+package web
+
+// SessionVO 登录设备的展示对象
+type SessionVO struct {
+	Ssid        string `json:"ssid"`
+	UserAgent   string `json:"userAgent"`
+	Ip          string `json:"ip"`
+	LoginTime   string `json:"loginTime"`
+	LastRefresh string `json:"lastRefresh"`
+	// Current 是否是当前正在使用的设备
+	Current bool `json:"current"`
+}
+
+// ArticleVO 文章的展示对象
+// 作者看到的列表只有摘要,读者看不到文章的状态等内部字段
+type ArticleVO struct {
+	Id       int64  `json:"id"`
+	Title    string `json:"title"`
+	Abstract string `json:"abstract,omitempty"`
+	Content  string `json:"content,omitempty"`
+	// 注意一点,状态这个东西,可以是前端来处理,也可以是后端处理
+	// 0 -> unknown -> 未知状态
+	// 1 -> 未发表,手机 APP 这种涉及到发版的问题,那么后端来处理
+	Status     uint8  `json:"status,omitempty"`
+	AuthorId   int64  `json:"authorId,omitempty"`
+	AuthorName string `json:"authorName,omitempty"`
+	Ctime      string `json:"ctime,omitempty"`
+	Utime      string `json:"utime,omitempty"`
+
+	// 点赞之类的信息
+	ReadCnt    int64 `json:"readCnt"`
+	LikeCnt    int64 `json:"likeCnt"`
+	CollectCnt int64 `json:"collectCnt"`
+
+	// 个人是否点赞的信息
+	Liked     bool `json:"liked"`
+	Collected bool `json:"collected"`
+
+	// 每种表态的数量和自己的表态,点赞也在里面
+	Reactions   map[string]int64 `json:"reactions,omitempty"`
+	MyReactions []string         `json:"myReactions,omitempty"`
+}
+
+// ArticleReq 编辑和发表文章的请求
+type ArticleReq struct {
+	Id      int64  `json:"id"`
+	Title   string `json:"title"`
+	Content string `json:"content"`
+}
+
+// Page 分页请求
+type Page struct {
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+}
+
+// HistoryVO 浏览记录的展示对象
+type HistoryVO struct {
+	Id       int64  `json:"id"`
+	Biz      string `json:"biz"`
+	BizId    int64  `json:"bizId"`
+	Title    string `json:"title"`
+	Abstract string `json:"abstract"`
+	// Position 和 Progress 是最近一次的阅读进度,继续阅读的时候用
+	Position int64 `json:"position"`
+	Progress int   `json:"progress"`
+	Finished bool  `json:"finished"`
+	// Duration 累计阅读时长,毫秒
+	Duration int64 `json:"duration"`
+	// Utime 最后一次浏览的时间
+	Utime string `json:"utime"`
+}
+
+// HistoryListVO 一页浏览记录,Cursor 为空表示没有下一页了
+type HistoryListVO struct {
+	Records []HistoryVO `json:"records"`
+	Cursor  string      `json:"cursor"`
+}
+
+// CursorPage 游标分页请求,第一页的 Cursor 为空
+type CursorPage struct {
+	Cursor string `json:"cursor"`
+	Limit  int    `json:"limit"`
+}
+
+// CollectionVO 收藏夹的展示对象
+type CollectionVO struct {
+	Id          int64  `json:"id"`
+	Uid         int64  `json:"uid"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Public      bool   `json:"public"`
+	ItemCnt     int64  `json:"itemCnt"`
+	Ctime       string `json:"ctime"`
+	Utime       string `json:"utime"`
+}
+
+// CollectionItemVO 收藏夹里面的一条收藏
+type CollectionItemVO struct {
+	Id       int64  `json:"id"`
+	Cid      int64  `json:"cid"`
+	Biz      string `json:"biz"`
+	BizId    int64  `json:"bizId"`
+	Title    string `json:"title"`
+	Abstract string `json:"abstract"`
+	Ctime    string `json:"ctime"`
+}
@@ -0,0 +1,182 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ClearloveHn/golangwebook/webook/internal/errs"
+	"github.com/ClearloveHn/golangwebook/webook/internal/service"
+	"github.com/ClearloveHn/golangwebook/webook/internal/service/oauth2/wechat"
+	ijwt "github.com/ClearloveHn/golangwebook/webook/internal/web/jwt"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"net/http"
+	"time"
+)
+
+const (
+	// stateCookieName 存放 state 的 cookie 的名字
+	stateCookieName = "jwt-state"
+	// stateCookiePath cookie 只在回调的时候带上
+	stateCookiePath = "/oauth2/wechat/callback"
+	// stateExpiration state 的有效期,用户需要在这个时间内完成扫码
+	stateExpiration = time.Minute * 10
+)
+
+var (
+	errStateMismatch = errors.New("state 不匹配")
+	// ErrEmptyStateKey 没有配置签名 state 的密钥,任何人都可以伪造 state cookie
+	ErrEmptyStateKey = errors.New("必须配置 state 的签名密钥")
+)
+
+var _ handler = &OAuth2WechatHandler{}
+
+// OAuth2WechatConfig 微信扫码登录的配置
+type OAuth2WechatConfig struct {
+	// StateKey 签名 state cookie 的密钥
+	StateKey []byte
+	// Secure 为 true 的时候 cookie 只在 HTTPS 下发送,生产环境必须开启
+	Secure bool
+}
+
+// OAuth2WechatHandler 微信扫码登录的 HTTP 处理器
+// 使用 state 来防止 CSRF 攻击: 跳转之前生成一个随机的 state,
+// 放到签名过的 cookie 里面,回调的时候比较微信带回来的 state 和 cookie 里面的是否一致
+type OAuth2WechatHandler struct {
+	svc     wechat.Service
+	userSvc service.UserService
+	ijwt.Handler
+	cfg OAuth2WechatConfig
+	l   logger.LoggerV1
+}
+
+// NewOAuth2WechatHandler cfg.StateKey 为空的时候返回 ErrEmptyStateKey
+func NewOAuth2WechatHandler(svc wechat.Service,
+	userSvc service.UserService,
+	jwtHdl ijwt.Handler,
+	cfg OAuth2WechatConfig,
+	l logger.LoggerV1) (*OAuth2WechatHandler, error) {
+	if len(cfg.StateKey) == 0 {
+		return nil, ErrEmptyStateKey
+	}
+	return &OAuth2WechatHandler{
+		svc:     svc,
+		userSvc: userSvc,
+		Handler: jwtHdl,
+		cfg:     cfg,
+		l:       l,
+	}, nil
+}
+
+// RegisterRoutes 注册微信登录的路由
+// 这两个路径都需要加入到登录校验中间件的 IgnorePaths 里面
+func (h *OAuth2WechatHandler) RegisterRoutes(server *gin.Engine) {
+	g := server.Group("/oauth2/wechat")
+	g.GET("/authurl", h.AuthURL)
+	// 这边用 Any 万无一失
+	g.Any("/callback", h.Callback)
+}
+
+// AuthURL 生成 state,写入 cookie,然后跳转到微信的授权页面
+func (h *OAuth2WechatHandler) AuthURL(ctx *gin.Context) {
+	state := uuid.New().String()
+	val, err := h.svc.AuthURL(ctx, state)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "构造跳转URL失败"})
+		return
+	}
+
+	err = h.setStateCookie(ctx, state)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+	ctx.Redirect(http.StatusFound, val)
+}
+
+// Callback 微信授权之后的回调,校验 state 之后用授权码换取用户信息并登录
+func (h *OAuth2WechatHandler) Callback(ctx *gin.Context) {
+	err := h.verifyState(ctx)
+	if err != nil {
+		// 要么是 cookie 过期了,要么是有人在搞 CSRF 攻击
+		h.l.Warn("微信登录 state 校验失败", logger.Error(err))
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "非法请求"})
+		return
+	}
+	// state 只能用一次
+	h.clearStateCookie(ctx)
+
+	code := ctx.Query("code")
+	wechatInfo, err := h.svc.VerifyCode(ctx, code)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "授权码有误"})
+		return
+	}
+
+	u, err := h.userSvc.FindOrCreateByWechat(ctx, wechatInfo)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+
+	err = h.SetLoginToken(ctx, u.Id)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "登录成功"})
+}
+
+// setStateCookie 把 state 签名之后放到 cookie 里面
+func (h *OAuth2WechatHandler) setStateCookie(ctx *gin.Context, state string) error {
+	claims := StateClaims{
+		State: state,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(stateExpiration)),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
+	tokenStr, err := token.SignedString(h.cfg.StateKey)
+	if err != nil {
+		return err
+	}
+	ctx.SetCookie(stateCookieName, tokenStr, int(stateExpiration.Seconds()),
+		stateCookiePath, "", h.cfg.Secure, true)
+	return nil
+}
+
+// clearStateCookie 删除 state cookie
+func (h *OAuth2WechatHandler) clearStateCookie(ctx *gin.Context) {
+	ctx.SetCookie(stateCookieName, "", -1, stateCookiePath, "", h.cfg.Secure, true)
+}
+
+// verifyState 比较回调里面的 state 和 cookie 里面的 state
+func (h *OAuth2WechatHandler) verifyState(ctx *gin.Context) error {
+	state := ctx.Query("state")
+	ck, err := ctx.Cookie(stateCookieName)
+	if err != nil {
+		return fmt.Errorf("无法获得 cookie %w", err)
+	}
+
+	var sc StateClaims
+	token, err := jwt.ParseWithClaims(ck, &sc, func(token *jwt.Token) (interface{}, error) {
+		return h.cfg.StateKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS512.Alg()}))
+	if err != nil {
+		return fmt.Errorf("解析 token 失败 %w", err)
+	}
+	if token == nil || !token.Valid {
+		return fmt.Errorf("token 已经过期了")
+	}
+	if state == "" || state != sc.State {
+		return errStateMismatch
+	}
+	return nil
+}
+
+// StateClaims 放在 cookie 里面的 state
+type StateClaims struct {
+	jwt.RegisteredClaims
+	State string
+}
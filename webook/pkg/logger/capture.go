@@ -0,0 +1,80 @@
+package logger
+
+import "sync"
+
+// Level 日志级别
+type Level string
+
+const (
+	LevelDebug Level = "debug"
+	LevelInfo  Level = "info"
+	LevelWarn  Level = "warn"
+	LevelError Level = "error"
+)
+
+// Entry 一条被记录下来的日志
+type Entry struct {
+	Level  Level
+	Msg    string
+	Fields []Field
+}
+
+// Field 根据键找到对应的字段
+func (e Entry) Field(key string) (Field, bool) {
+	for _, f := range e.Fields {
+		if f.Key == key {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// CaptureLogger 把日志记录在内存里面,用在测试里面断言打了什么日志
+type CaptureLogger struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+func NewCaptureLogger() *CaptureLogger {
+	return &CaptureLogger{}
+}
+
+func (c *CaptureLogger) Debug(msg string, args ...Field) {
+	c.append(LevelDebug, msg, args)
+}
+
+func (c *CaptureLogger) Info(msg string, args ...Field) {
+	c.append(LevelInfo, msg, args)
+}
+
+func (c *CaptureLogger) Warn(msg string, args ...Field) {
+	c.append(LevelWarn, msg, args)
+}
+
+func (c *CaptureLogger) Error(msg string, args ...Field) {
+	c.append(LevelError, msg, args)
+}
+
+// Entries 返回所有记录下来的日志的拷贝
+func (c *CaptureLogger) Entries() []Entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	res := make([]Entry, len(c.entries))
+	copy(res, c.entries)
+	return res
+}
+
+// Reset 清空记录下来的日志
+func (c *CaptureLogger) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = nil
+}
+
+func (c *CaptureLogger) append(level Level, msg string, args []Field) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fields := make([]Field, len(args))
+	copy(fields, args)
+	c.entries = append(c.entries, Entry{Level: level, Msg: msg, Fields: fields})
+}
@@ -0,0 +1,37 @@
+package logger
+
+import "time"
+
+func String(key, val string) Field {
+	return Field{Key: key, Val: val}
+}
+
+func Int(key string, val int) Field {
+	return Field{Key: key, Val: val}
+}
+
+func Int32(key string, val int32) Field {
+	return Field{Key: key, Val: val}
+}
+
+func Int64(key string, val int64) Field {
+	return Field{Key: key, Val: val}
+}
+
+func Bool(key string, val bool) Field {
+	return Field{Key: key, Val: val}
+}
+
+func Duration(key string, val time.Duration) Field {
+	return Field{Key: key, Val: val}
+}
+
+// Error 错误统一使用 "error" 作为键
+func Error(err error) Field {
+	return Field{Key: "error", Val: err}
+}
+
+// Any 任意类型,尽量少用
+func Any(key string, val any) Field {
+	return Field{Key: key, Val: val}
+}
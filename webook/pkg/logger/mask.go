@@ -0,0 +1,365 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// 日志脱敏
+// 字段名匹配上规则的时候,整个值都会被脱敏;
+// 字段名没有匹配上的时候,字符串里面符合规则 Pattern 的部分会被脱敏。
+// 结构体、map、切片之类的值会先转成 JSON 再逐个字段处理,所以嵌套的字段也能脱敏。
+
+const maskPlaceholder = "****"
+
+// MaskRule 一条脱敏规则
+type MaskRule struct {
+	Name string
+	// Fields 字段名,匹配的时候忽略大小写、下划线和中划线
+	Fields []string
+	// Pattern 用于在任意字符串里面查找敏感信息,可以为 nil
+	Pattern *regexp.Regexp
+	// KeepPrefix 和 KeepSuffix 是脱敏之后保留的前后字符数
+	KeepPrefix int
+	KeepSuffix int
+	// Masker 自定义的脱敏方法,设置了之后 KeepPrefix 和 KeepSuffix 不再生效
+	Masker func(val string) string
+}
+
+// Mask 对一个值整体脱敏
+func (r MaskRule) Mask(val string) string {
+	if r.Masker != nil {
+		return r.Masker(val)
+	}
+	runes := []rune(val)
+	if len(runes) <= r.KeepPrefix+r.KeepSuffix {
+		return maskPlaceholder
+	}
+	return string(runes[:r.KeepPrefix]) + maskPlaceholder + string(runes[len(runes)-r.KeepSuffix:])
+}
+
+// DefaultMaskRules 默认的脱敏规则,覆盖手机号、邮箱、验证码、JWT 和微信的 openid
+func DefaultMaskRules() []MaskRule {
+	return []MaskRule{
+		{
+			Name: "phone",
+			// 只匹配明确是手机号的字段名,number 之类的通用字段名会误伤其它数据
+			Fields: []string{"phone", "phones", "phoneNumber", "phoneNumbers", "phoneNumberSet",
+				"mobile", "mobiles"},
+			Pattern:    regexp.MustCompile(`\b(?:86)?1[3-9]\d{9}\b`),
+			KeepPrefix: 3,
+			KeepSuffix: 4,
+		},
+		{
+			Name:    "email",
+			Fields:  []string{"email", "mail"},
+			Pattern: regexp.MustCompile(`[\w.+-]+@[\w-]+(?:\.[\w-]+)+`),
+			Masker:  maskEmail,
+		},
+		{
+			// 验证码只能按照字段名匹配,按照数字去匹配会误伤其它数据
+			// 短信模板参数里面一般就是验证码
+			Name:   "code",
+			Fields: []string{"code", "codes", "otp", "verifyCode", "smsCode", "tplParams"},
+		},
+		{
+			Name: "jwt",
+			Fields: []string{"token", "jwt", "accessToken", "refreshToken",
+				"authorization", "x-jwt-token", "x-refresh-token"},
+			Pattern:    regexp.MustCompile(`eyJ[\w-]+\.[\w-]+\.[\w-]*`),
+			KeepPrefix: 6,
+		},
+		{
+			Name:       "openid",
+			Fields:     []string{"openId", "unionId"},
+			Pattern:    regexp.MustCompile(`\bo[\w-]{26,28}\b`),
+			KeepPrefix: 4,
+			KeepSuffix: 4,
+		},
+	}
+}
+
+// maskEmail 保留用户名的第一个字符和域名
+func maskEmail(val string) string {
+	idx := strings.LastIndexByte(val, '@')
+	if idx <= 0 {
+		return maskPlaceholder
+	}
+	return string([]rune(val)[:1]) + maskPlaceholder + val[idx:]
+}
+
+// MaskRuleConfig 脱敏规则的配置
+type MaskRuleConfig struct {
+	Name       string   `yaml:"name"`
+	Fields     []string `yaml:"fields"`
+	Pattern    string   `yaml:"pattern"`
+	KeepPrefix int      `yaml:"keepPrefix"`
+	KeepSuffix int      `yaml:"keepSuffix"`
+	// Disabled 为 true 的时候删除同名的规则,比如说本地开发的时候想看到验证码
+	Disabled bool `yaml:"disabled"`
+}
+
+// MaskConfig 脱敏的配置
+type MaskConfig struct {
+	// NoDefault 为 true 的时候不使用默认规则
+	NoDefault bool             `yaml:"noDefault"`
+	Rules     []MaskRuleConfig `yaml:"rules"`
+}
+
+// NewMaskRules 根据配置生成脱敏规则
+// 配置里面的规则和默认规则同名的时候会覆盖默认规则,否则追加到后面
+func NewMaskRules(cfg MaskConfig) ([]MaskRule, error) {
+	var rules []MaskRule
+	if !cfg.NoDefault {
+		rules = DefaultMaskRules()
+	}
+	for _, rc := range cfg.Rules {
+		if rc.Name == "" {
+			return nil, errors.New("脱敏规则必须有名字")
+		}
+		idx := -1
+		for i, r := range rules {
+			if r.Name == rc.Name {
+				idx = i
+				break
+			}
+		}
+		if rc.Disabled {
+			if idx >= 0 {
+				rules = append(rules[:idx], rules[idx+1:]...)
+			}
+			continue
+		}
+
+		if len(rc.Fields) == 0 && rc.Pattern == "" {
+			return nil, fmt.Errorf("脱敏规则 %s 至少要配置 fields 或者 pattern", rc.Name)
+		}
+		rule := MaskRule{
+			Name:       rc.Name,
+			Fields:     rc.Fields,
+			KeepPrefix: rc.KeepPrefix,
+			KeepSuffix: rc.KeepSuffix,
+		}
+		if rc.Pattern != "" {
+			reg, err := regexp.Compile(rc.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("脱敏规则 %s 的 pattern 不合法 %w", rc.Name, err)
+			}
+			rule.Pattern = reg
+		}
+		if idx >= 0 {
+			rules[idx] = rule
+		} else {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// masker 根据规则对日志的内容进行脱敏
+type masker struct {
+	fields   map[string]*MaskRule
+	patterns []*MaskRule
+}
+
+func newMasker(rules []MaskRule) *masker {
+	m := &masker{fields: make(map[string]*MaskRule)}
+	for i := range rules {
+		r := &rules[i]
+		for _, f := range r.Fields {
+			m.fields[normalizeKey(f)] = r
+		}
+		if r.Pattern != nil {
+			m.patterns = append(m.patterns, r)
+		}
+	}
+	return m
+}
+
+func normalizeKey(key string) string {
+	key = strings.ToLower(key)
+	return strings.NewReplacer("_", "", "-", "").Replace(key)
+}
+
+func (m *masker) rule(key string) *MaskRule {
+	if key == "" {
+		return nil
+	}
+	return m.fields[normalizeKey(key)]
+}
+
+// maskString 把字符串里面符合规则的部分脱敏
+func (m *masker) maskString(val string) string {
+	for _, r := range m.patterns {
+		val = r.Pattern.ReplaceAllStringFunc(val, r.Mask)
+	}
+	return val
+}
+
+// maskValue 对一个字段的值脱敏
+func (m *masker) maskValue(key string, val any) any {
+	if val == nil {
+		return nil
+	}
+	if r := m.rule(key); r != nil {
+		return m.maskAll(r, val)
+	}
+	if isScalar(val) {
+		return val
+	}
+
+	switch v := val.(type) {
+	case string:
+		return m.maskString(v)
+	case []string:
+		res := make([]string, len(v))
+		for i, s := range v {
+			res[i] = m.maskString(s)
+		}
+		return res
+	case error:
+		msg := m.maskString(v.Error())
+		if msg == v.Error() {
+			return v
+		}
+		return errors.New(msg)
+	case fmt.Stringer:
+		return m.maskString(v.String())
+	}
+
+	tree, ok := toJSONTree(val)
+	if !ok {
+		return m.maskString(fmt.Sprintf("%+v", val))
+	}
+	return m.maskTree("", tree)
+}
+
+// maskAll 字段名匹配上了,整个值都要脱敏
+func (m *masker) maskAll(r *MaskRule, val any) any {
+	switch v := val.(type) {
+	case string:
+		return r.Mask(v)
+	case []string:
+		res := make([]string, len(v))
+		for i, s := range v {
+			res[i] = r.Mask(s)
+		}
+		return res
+	}
+
+	tree, ok := toJSONTree(val)
+	if !ok {
+		return maskPlaceholder
+	}
+	return m.maskTreeAll(r, tree)
+}
+
+// maskTree 处理 JSON 解析出来的值,字段名匹配上的整个脱敏,其余的按照 Pattern 脱敏
+func (m *masker) maskTree(key string, val any) any {
+	if r := m.rule(key); r != nil {
+		return m.maskTreeAll(r, val)
+	}
+	switch v := val.(type) {
+	case string:
+		return m.maskString(v)
+	case map[string]any:
+		for k, sub := range v {
+			v[k] = m.maskTree(k, sub)
+		}
+		return v
+	case []any:
+		for i, sub := range v {
+			v[i] = m.maskTree("", sub)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func (m *masker) maskTreeAll(r *MaskRule, val any) any {
+	switch v := val.(type) {
+	case nil:
+		return nil
+	case map[string]any:
+		for k, sub := range v {
+			v[k] = m.maskTreeAll(r, sub)
+		}
+		return v
+	case []any:
+		for i, sub := range v {
+			v[i] = m.maskTreeAll(r, sub)
+		}
+		return v
+	default:
+		return r.Mask(fmt.Sprint(v))
+	}
+}
+
+// toJSONTree 把任意的值转成 JSON 对应的 map、切片和基本类型
+func toJSONTree(val any) (any, bool) {
+	data, err := json.Marshal(val)
+	if err != nil {
+		return nil, false
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	// 避免 int64 变成 float64 之后丢失精度
+	dec.UseNumber()
+	var res any
+	if err = dec.Decode(&res); err != nil {
+		return nil, false
+	}
+	return res, true
+}
+
+func isScalar(val any) bool {
+	switch reflect.ValueOf(val).Kind() {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return true
+	default:
+		return false
+	}
+}
+
+// MaskLogger 在打印日志之前对敏感信息脱敏的装饰器
+type MaskLogger struct {
+	l LoggerV1
+	m *masker
+}
+
+// NewMaskLogger 创建脱敏的日志记录器,一般传入 DefaultMaskRules 或者 NewMaskRules 的结果
+func NewMaskLogger(l LoggerV1, rules ...MaskRule) *MaskLogger {
+	return &MaskLogger{l: l, m: newMasker(rules)}
+}
+
+func (m *MaskLogger) Debug(msg string, args ...Field) {
+	m.l.Debug(m.m.maskString(msg), m.maskFields(args)...)
+}
+
+func (m *MaskLogger) Info(msg string, args ...Field) {
+	m.l.Info(m.m.maskString(msg), m.maskFields(args)...)
+}
+
+func (m *MaskLogger) Warn(msg string, args ...Field) {
+	m.l.Warn(m.m.maskString(msg), m.maskFields(args)...)
+}
+
+func (m *MaskLogger) Error(msg string, args ...Field) {
+	m.l.Error(m.m.maskString(msg), m.maskFields(args)...)
+}
+
+func (m *MaskLogger) maskFields(args []Field) []Field {
+	res := make([]Field, 0, len(args))
+	for _, arg := range args {
+		res = append(res, Field{Key: arg.Key, Val: m.m.maskValue(arg.Key, arg.Val)})
+	}
+	return res
+}
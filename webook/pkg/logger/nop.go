@@ -0,0 +1,21 @@
+package logger
+
+// NopLogger 什么也不做的实现,一般用在测试里面
+type NopLogger struct {
+}
+
+func NewNopLogger() LoggerV1 {
+	return &NopLogger{}
+}
+
+func (n *NopLogger) Debug(msg string, args ...Field) {
+}
+
+func (n *NopLogger) Info(msg string, args ...Field) {
+}
+
+func (n *NopLogger) Warn(msg string, args ...Field) {
+}
+
+func (n *NopLogger) Error(msg string, args ...Field) {
+}
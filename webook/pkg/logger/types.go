@@ -0,0 +1,15 @@
+package logger
+
+// LoggerV1 日志的抽象,业务代码都依赖这个接口,而不是直接依赖 zap
+type LoggerV1 interface {
+	Debug(msg string, args ...Field)
+	Info(msg string, args ...Field)
+	Warn(msg string, args ...Field)
+	Error(msg string, args ...Field)
+}
+
+// Field 日志里面的一个键值对
+type Field struct {
+	Key string
+	Val any
+}
@@ -0,0 +1,37 @@
+package logger
+
+import "go.uber.org/zap"
+
+// ZapLogger 基于 zap 的 LoggerV1 实现
+type ZapLogger struct {
+	l *zap.Logger
+}
+
+func NewZapLogger(l *zap.Logger) *ZapLogger {
+	return &ZapLogger{l: l}
+}
+
+func (z *ZapLogger) Debug(msg string, args ...Field) {
+	z.l.Debug(msg, z.toArgs(args)...)
+}
+
+func (z *ZapLogger) Info(msg string, args ...Field) {
+	z.l.Info(msg, z.toArgs(args)...)
+}
+
+func (z *ZapLogger) Warn(msg string, args ...Field) {
+	z.l.Warn(msg, z.toArgs(args)...)
+}
+
+func (z *ZapLogger) Error(msg string, args ...Field) {
+	z.l.Error(msg, z.toArgs(args)...)
+}
+
+// toArgs 把 Field 转成 zap.Field,zap.Any 会根据值的类型选择合适的编码方式
+func (z *ZapLogger) toArgs(args []Field) []zap.Field {
+	res := make([]zap.Field, 0, len(args))
+	for _, arg := range args {
+		res = append(res, zap.Any(arg.Key, arg.Val))
+	}
+	return res
+}
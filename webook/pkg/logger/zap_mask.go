@@ -0,0 +1,62 @@
+package logger
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// maskCore 对 zap 的日志进行脱敏,用于那些直接使用 *zap.Logger 的地方
+type maskCore struct {
+	zapcore.Core
+	m *masker
+}
+
+// NewMaskCore 包装 zapcore.Core,写日志之前先脱敏
+// 可以通过 zap.WrapCore 用在已有的 *zap.Logger 上
+func NewMaskCore(core zapcore.Core, rules ...MaskRule) zapcore.Core {
+	return &maskCore{Core: core, m: newMasker(rules)}
+}
+
+func (c *maskCore) With(fields []zapcore.Field) zapcore.Core {
+	return &maskCore{Core: c.Core.With(c.maskFields(fields)), m: c.m}
+}
+
+func (c *maskCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *maskCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	ent.Message = c.m.maskString(ent.Message)
+	return c.Core.Write(ent, c.maskFields(fields))
+}
+
+func (c *maskCore) maskFields(fields []zapcore.Field) []zapcore.Field {
+	res := make([]zapcore.Field, 0, len(fields))
+	for _, f := range fields {
+		if f.Type == zapcore.NamespaceType || f.Type == zapcore.SkipType ||
+			(c.m.rule(f.Key) == nil && !carriesText(f.Type)) {
+			res = append(res, f)
+			continue
+		}
+		// 借助 MapObjectEncoder 拿到字段的值,这样各种类型的字段都可以统一处理
+		enc := zapcore.NewMapObjectEncoder()
+		f.AddTo(enc)
+		res = append(res, zap.Any(f.Key, c.m.maskValue(f.Key, enc.Fields[f.Key])))
+	}
+	return res
+}
+
+// carriesText 这些类型的字段里面可能有字符串,需要检查
+func carriesText(t zapcore.FieldType) bool {
+	switch t {
+	case zapcore.StringType, zapcore.StringerType, zapcore.ErrorType,
+		zapcore.ByteStringType, zapcore.ReflectType,
+		zapcore.ArrayMarshalerType, zapcore.ObjectMarshalerType, zapcore.InlineMarshalerType:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,151 @@
+package samarax
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
+	"github.com/IBM/sarama"
+	"time"
+)
+
+// BatchHandler 批量处理消息的 sarama.ConsumerGroupHandler
+// 凑够 batchSize 条消息,或者距离这一批的第一次拉取超过了 batchDuration,就处理一批
+type BatchHandler[T any] struct {
+	l             logger.LoggerV1
+	fn            func(msgs []*sarama.ConsumerMessage, ts []T) error
+	batchSize     int
+	batchDuration time.Duration
+	retryCnt      int
+	retryInterval time.Duration
+	commit        CommitStrategy
+	// fallback 重试之后依旧失败的兜底
+	fallback func(msgs []*sarama.ConsumerMessage, err error) error
+}
+
+func NewBatchHandler[T any](l logger.LoggerV1,
+	fn func(msgs []*sarama.ConsumerMessage, ts []T) error) *BatchHandler[T] {
+	return &BatchHandler[T]{
+		l:             l,
+		fn:            fn,
+		batchSize:     defaultBatchSize,
+		batchDuration: defaultBatchDuration,
+		retryCnt:      defaultRetryCnt,
+		retryInterval: defaultRetryInterval,
+		commit:        CommitAuto,
+	}
+}
+
+// WithBatchSize 设置一批最多多少条消息
+func (b *BatchHandler[T]) WithBatchSize(size int) *BatchHandler[T] {
+	b.batchSize = size
+	return b
+}
+
+// WithBatchDuration 设置一批最多等待多长时间
+func (b *BatchHandler[T]) WithBatchDuration(d time.Duration) *BatchHandler[T] {
+	b.batchDuration = d
+	return b
+}
+
+// WithRetry 设置处理失败之后的重试次数和重试间隔,cnt 为 0 的时候不重试
+func (b *BatchHandler[T]) WithRetry(cnt int, interval time.Duration) *BatchHandler[T] {
+	b.retryCnt = cnt
+	b.retryInterval = interval
+	return b
+}
+
+// WithFallback 设置重试之后依旧失败的兜底方法,兜底成功的这一批消息会被提交
+func (b *BatchHandler[T]) WithFallback(fn func(msgs []*sarama.ConsumerMessage, err error) error) *BatchHandler[T] {
+	b.fallback = fn
+	return b
+}
+
+// WithCommitStrategy 设置位移的提交策略,默认是 CommitAuto
+func (b *BatchHandler[T]) WithCommitStrategy(strategy CommitStrategy) *BatchHandler[T] {
+	b.commit = strategy
+	return b
+}
+
+func (b *BatchHandler[T]) Setup(session sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (b *BatchHandler[T]) Cleanup(session sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// ConsumeClaim 攒批处理消息,一批全部成功之后才提交这一批
+func (b *BatchHandler[T]) ConsumeClaim(session sarama.ConsumerGroupSession,
+	claim sarama.ConsumerGroupClaim) error {
+	msgsCh := claim.Messages()
+	for {
+		// batch 里面的消息和 ts 一一对应,skipped 是反序列化失败的消息,跟着这一批一起提交
+		batch := make([]*sarama.ConsumerMessage, 0, b.batchSize)
+		ts := make([]T, 0, b.batchSize)
+		var skipped []*sarama.ConsumerMessage
+
+		ctx, cancel := context.WithTimeout(session.Context(), b.batchDuration)
+		done, closed := false, false
+		for len(batch) < b.batchSize && !done {
+			select {
+			case <-ctx.Done():
+				// 超时了,或者发生了再均衡
+				done = true
+			case msg, ok := <-msgsCh:
+				if !ok {
+					done, closed = true, true
+					break
+				}
+				var t T
+				err := json.Unmarshal(msg.Value, &t)
+				if err != nil {
+					b.l.Error("反序列化消息失败",
+						logger.String("topic", msg.Topic),
+						logger.Int32("partition", msg.Partition),
+						logger.Int64("offset", msg.Offset),
+						logger.Error(err))
+					skipped = append(skipped, msg)
+					continue
+				}
+				batch = append(batch, msg)
+				ts = append(ts, t)
+			}
+		}
+		cancel()
+
+		b.flush(session, batch, ts, skipped)
+		if closed || session.Context().Err() != nil {
+			return nil
+		}
+	}
+}
+
+func (b *BatchHandler[T]) flush(session sarama.ConsumerGroupSession,
+	batch []*sarama.ConsumerMessage, ts []T, skipped []*sarama.ConsumerMessage) {
+	if len(batch) > 0 {
+		err := retry(b.retryCnt, b.retryInterval, func() error {
+			return b.fn(batch, ts)
+		})
+		if err != nil && b.fallback != nil {
+			err = b.fallback(batch, err)
+		}
+		if err != nil {
+			last := batch[len(batch)-1]
+			b.l.Error("批量处理消息失败",
+				logger.String("topic", last.Topic),
+				logger.Int32("partition", last.Partition),
+				logger.Int64("firstOffset", batch[0].Offset),
+				logger.Int64("lastOffset", last.Offset),
+				logger.Error(err))
+			return
+		}
+	}
+
+	for _, msg := range batch {
+		session.MarkMessage(msg, "")
+	}
+	for _, msg := range skipped {
+		session.MarkMessage(msg, "")
+	}
+	commit(session, b.commit)
+}
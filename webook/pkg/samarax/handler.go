@@ -0,0 +1,122 @@
+package samarax
+
+import (
+	"encoding/json"
+	"github.com/ClearloveHn/golangwebook/webook/pkg/logger"
+	"github.com/IBM/sarama"
+	"time"
+)
+
+// Handler 逐条处理消息的 sarama.ConsumerGroupHandler
+type Handler[T any] struct {
+	l             logger.LoggerV1
+	fn            func(msg *sarama.ConsumerMessage, t T) error
+	retryCnt      int
+	retryInterval time.Duration
+	commit        CommitStrategy
+	// fallback 重试之后依旧失败的兜底
+	fallback func(msg *sarama.ConsumerMessage, err error) error
+	// delays 每个 topic 的消息要延迟多久才处理,从消息的时间戳开始算
+	delays map[string]time.Duration
+}
+
+func NewHandler[T any](l logger.LoggerV1,
+	fn func(msg *sarama.ConsumerMessage, t T) error) *Handler[T] {
+	return &Handler[T]{
+		l:             l,
+		fn:            fn,
+		retryCnt:      defaultRetryCnt,
+		retryInterval: defaultRetryInterval,
+		commit:        CommitAuto,
+	}
+}
+
+// WithRetry 设置处理失败之后的重试次数和重试间隔,cnt 为 0 的时候不重试
+func (h *Handler[T]) WithRetry(cnt int, interval time.Duration) *Handler[T] {
+	h.retryCnt = cnt
+	h.retryInterval = interval
+	return h
+}
+
+// WithFallback 设置重试之后依旧失败的兜底方法,兜底成功的消息会被提交
+func (h *Handler[T]) WithFallback(fn func(msg *sarama.ConsumerMessage, err error) error) *Handler[T] {
+	h.fallback = fn
+	return h
+}
+
+// WithDelay 设置某个 topic 的消息延迟多久才处理,用于重试 topic
+func (h *Handler[T]) WithDelay(topic string, d time.Duration) *Handler[T] {
+	if h.delays == nil {
+		h.delays = make(map[string]time.Duration)
+	}
+	h.delays[topic] = d
+	return h
+}
+
+// WithCommitStrategy 设置位移的提交策略,默认是 CommitAuto
+func (h *Handler[T]) WithCommitStrategy(strategy CommitStrategy) *Handler[T] {
+	h.commit = strategy
+	return h
+}
+
+func (h *Handler[T]) Setup(session sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (h *Handler[T]) Cleanup(session sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// ConsumeClaim 逐条反序列化并处理消息,成功之后才提交
+func (h *Handler[T]) ConsumeClaim(session sarama.ConsumerGroupSession,
+	claim sarama.ConsumerGroupClaim) error {
+	msgs := claim.Messages()
+	for {
+		select {
+		case <-session.Context().Done():
+			// 发生了再均衡或者消费者关闭
+			return nil
+		case msg, ok := <-msgs:
+			if !ok {
+				return nil
+			}
+			d, ok := h.delays[msg.Topic]
+			if ok && !waitUntil(session.Context(), msg.Timestamp.Add(d)) {
+				return nil
+			}
+			h.consume(session, msg)
+		}
+	}
+}
+
+func (h *Handler[T]) consume(session sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage) {
+	var t T
+	err := json.Unmarshal(msg.Value, &t)
+	if err != nil {
+		h.l.Error("反序列化消息失败",
+			logger.String("topic", msg.Topic),
+			logger.Int32("partition", msg.Partition),
+			logger.Int64("offset", msg.Offset),
+			logger.Error(err))
+		session.MarkMessage(msg, "")
+		commit(session, h.commit)
+		return
+	}
+
+	err = retry(h.retryCnt, h.retryInterval, func() error {
+		return h.fn(msg, t)
+	})
+	if err != nil && h.fallback != nil {
+		err = h.fallback(msg, err)
+	}
+	if err != nil {
+		h.l.Error("处理消息失败",
+			logger.String("topic", msg.Topic),
+			logger.Int32("partition", msg.Partition),
+			logger.Int64("offset", msg.Offset),
+			logger.Error(err))
+		return
+	}
+	session.MarkMessage(msg, "")
+	commit(session, h.commit)
+}
@@ -0,0 +1,58 @@
+package samarax
+
+import (
+	"fmt"
+	"github.com/IBM/sarama"
+)
+
+// Router 一个消费者组订阅多个 topic,每个 topic 的消息格式不一样的时候,
+// 根据 topic 把消息交给不同的处理器
+type Router struct {
+	handlers map[string]sarama.ConsumerGroupHandler
+}
+
+func NewRouter() *Router {
+	return &Router{handlers: make(map[string]sarama.ConsumerGroupHandler)}
+}
+
+// Handle 注册 topic 的处理器
+func (r *Router) Handle(topic string, h sarama.ConsumerGroupHandler) *Router {
+	r.handlers[topic] = h
+	return r
+}
+
+// Topics 返回所有注册了处理器的 topic,用于 Consume
+func (r *Router) Topics() []string {
+	res := make([]string, 0, len(r.handlers))
+	for topic := range r.handlers {
+		res = append(res, topic)
+	}
+	return res
+}
+
+func (r *Router) Setup(session sarama.ConsumerGroupSession) error {
+	for _, h := range r.handlers {
+		if err := h.Setup(session); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Router) Cleanup(session sarama.ConsumerGroupSession) error {
+	for _, h := range r.handlers {
+		if err := h.Cleanup(session); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Router) ConsumeClaim(session sarama.ConsumerGroupSession,
+	claim sarama.ConsumerGroupClaim) error {
+	h, ok := r.handlers[claim.Topic()]
+	if !ok {
+		return fmt.Errorf("topic %s 没有注册处理器", claim.Topic())
+	}
+	return h.ConsumeClaim(session, claim)
+}
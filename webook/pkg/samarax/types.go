@@ -0,0 +1,63 @@
+package samarax
+
+import (
+	"context"
+	"github.com/IBM/sarama"
+	"time"
+)
+
+// 基于 sarama 的消费者处理器的封装
+// 负责把消息反序列化成具体的类型,处理失败的时候重试,处理成功之后再提交位移。
+// 反序列化失败的消息重试也没有用,打印日志之后直接提交,避免一直卡在这条消息上。
+// 重试之后依旧失败的消息不会提交,但是后面的消息处理成功之后提交的位移会越过它,
+// 所以业务上不能丢的消息需要通过 WithFallback 兜底,例如转发到重试 topic,兜底成功之后才提交。
+
+const (
+	defaultRetryCnt      = 3
+	defaultRetryInterval = time.Millisecond * 100
+	defaultBatchSize     = 10
+	defaultBatchDuration = time.Second
+)
+
+// CommitStrategy 位移的提交策略
+type CommitStrategy string
+
+const (
+	// CommitAuto 只标记位移,由 sarama 定期自动提交,性能好,但是进程崩溃的时候可能会重复消费一小段
+	CommitAuto CommitStrategy = "auto"
+	// CommitSync 每处理完一条或者一批之后马上同步提交,重复消费最少,但是性能差一些
+	CommitSync CommitStrategy = "sync"
+)
+
+// commit 按照策略提交已经标记的位移
+func commit(session sarama.ConsumerGroupSession, strategy CommitStrategy) {
+	if strategy == CommitSync {
+		session.Commit()
+	}
+}
+
+// waitUntil 等到 t 时刻,ctx 结束的时候返回 false
+func waitUntil(ctx context.Context, t time.Time) bool {
+	d := time.Until(t)
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// retry 执行 fn,失败的时候最多重试 cnt 次
+func retry(cnt int, interval time.Duration, fn func() error) error {
+	err := fn()
+	for i := 0; i < cnt && err != nil; i++ {
+		time.Sleep(interval)
+		err = fn()
+	}
+	return err
+}